@@ -0,0 +1,182 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"omnivorous/internal/archive"
+	"omnivorous/internal/downloaders"
+	"os"
+	"strings"
+)
+
+// errNotStarted is the reason of jobs that were not started because an earlier job failed
+var errNotStarted = errors.New("not started after an earlier failure")
+
+// errInterrupted is the reason of jobs that were not started because the batch was interrupted
+var errInterrupted = errors.New("not started, interrupted")
+
+// job is a single URL of a batch and its outcome
+type job struct {
+	url string
+	err error
+}
+
+func (j job) skipped() bool {
+	return errors.Is(j.err, downloaders.ErrSkipped) || errors.Is(j.err, errNotStarted) || errors.Is(j.err, errInterrupted)
+}
+
+// interrupted reports whether the job was stopped or not started because of Ctrl-C
+func (j job) interrupted() bool {
+	return errors.Is(j.err, context.Canceled) || errors.Is(j.err, errInterrupted)
+}
+
+func (j job) failed() bool {
+	return j.err != nil && !j.skipped()
+}
+
+// parseArgs parses the command line flags, which may appear before, between and after the URLs
+// It returns the positional arguments
+func parseArgs(args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := flag.CommandLine.Parse(args); err != nil {
+			return nil, err
+		}
+
+		args = flag.Args()
+		if len(args) == 0 {
+			return positional, nil
+		}
+
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+// readBatchFile reads URLs from the file, one per line, "-" reads from stdin
+// Empty lines and lines starting with # are ignored
+func readBatchFile(name string) ([]string, error) {
+	var r io.Reader = os.Stdin
+	if name != "-" {
+		file, err := os.Open(name)
+		if err != nil {
+			return nil, fmt.Errorf("error opening batch file: %w", err)
+		}
+		defer file.Close()
+		r = file
+	}
+
+	var urls []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		urls = append(urls, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading batch file: %w", err)
+	}
+
+	return urls, nil
+}
+
+// runJobs downloads the URLs one after another
+// Unless continueOnError is set, the jobs after the first failed one are not started
+func runJobs(ctx context.Context, urls []string, opts downloaders.Options, videoArchive *archive.Archive, continueOnError bool) []job {
+	jobs := make([]job, len(urls))
+
+	failed := false
+	for i, rawUrl := range urls {
+		jobs[i].url = rawUrl
+
+		if ctx.Err() != nil {
+			jobs[i].err = errInterrupted
+			continue
+		}
+
+		if failed && !continueOnError {
+			jobs[i].err = errNotStarted
+			continue
+		}
+
+		if len(urls) > 1 {
+			// progress goes to stderr like the progress bars, stdout only carries results
+			fmt.Fprintf(os.Stderr, "[%d/%d] %s\n", i+1, len(urls), rawUrl)
+		}
+
+		jobs[i].err = download(ctx, rawUrl, opts, videoArchive)
+
+		switch {
+		case jobs[i].skipped():
+			fmt.Fprintln(os.Stderr, jobs[i].err)
+		case jobs[i].failed():
+			printError(jobs[i].err)
+			failed = true
+		}
+	}
+
+	return jobs
+}
+
+// download downloads a single URL, videos recorded in the archive are skipped and successful downloads are recorded
+// The archive may be nil
+func download(ctx context.Context, rawUrl string, opts downloaders.Options, videoArchive *archive.Archive) error {
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		return fmt.Errorf("invalid URL: %w", err)
+	}
+
+	d, err := downloaders.Find(u)
+	if err != nil {
+		return err
+	}
+
+	// listing formats and simulating download nothing, so the archive is neither checked nor updated
+	if videoArchive == nil || opts.ListFormats || opts.Simulate {
+		return d.Download(ctx, u, opts)
+	}
+
+	if videoArchive.Has(d.Name(), d.ID(u)) {
+		return fmt.Errorf("%w: %s:%s is in the download archive", downloaders.ErrSkipped, d.Name(), d.ID(u))
+	}
+
+	if err := d.Download(ctx, u, opts); err != nil {
+		return err
+	}
+
+	return videoArchive.Add(d.Name(), d.ID(u))
+}
+
+// printSummary prints the totals and the outcome of every job that did not succeed to stderr
+func printSummary(jobs []job) {
+	var succeeded, failed, skipped int
+	for _, j := range jobs {
+		switch {
+		case j.failed():
+			failed++
+		case j.skipped():
+			skipped++
+		default:
+			succeeded++
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "\nSummary: %d succeeded, %d failed, %d skipped\n", succeeded, failed, skipped)
+	for _, j := range jobs {
+		switch {
+		case j.failed():
+			fmt.Fprintf(os.Stderr, "  failed   %s: %v\n", j.url, j.err)
+		case j.skipped():
+			// the reason of skipped downloads already starts with "skipped: "
+			reason := strings.TrimPrefix(j.err.Error(), downloaders.ErrSkipped.Error()+": ")
+			fmt.Fprintf(os.Stderr, "  skipped  %s: %s\n", j.url, reason)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package archive
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Archive records the videos that were downloaded, one "service:id" line per video
+// Lines are only appended, so several runs may share the same file
+type Archive struct {
+	path    string
+	mutex   sync.Mutex
+	entries map[string]bool
+}
+
+// Open reads the archive file, a missing file is an empty archive
+func Open(path string) (*Archive, error) {
+	a := &Archive{path: path, entries: make(map[string]bool)}
+
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return a, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error opening download archive: %w", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			a.entries[line] = true
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading download archive: %w", err)
+	}
+
+	return a, nil
+}
+
+// Has reports whether the video is recorded in the archive
+func (a *Archive) Has(service, id string) bool {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	return a.entries[entry(service, id)]
+}
+
+// Add records the video in the archive file
+func (a *Archive) Add(service, id string) error {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	e := entry(service, id)
+	if a.entries[e] {
+		return nil
+	}
+
+	file, err := os.OpenFile(a.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("error opening download archive: %w", err)
+	}
+	defer file.Close()
+
+	if _, err := file.WriteString(e + "\n"); err != nil {
+		return fmt.Errorf("error writing download archive: %w", err)
+	}
+
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("error writing download archive: %w", err)
+	}
+
+	a.entries[e] = true
+
+	return nil
+}
+
+func entry(service, id string) string {
+	return service + ":" + id
+}
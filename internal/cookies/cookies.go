@@ -0,0 +1,271 @@
+package cookies
+
+import (
+	"bufio"
+	"fmt"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// httpOnlyPrefix marks HttpOnly cookies in cookies.txt files written by browsers and curl
+const httpOnlyPrefix = "#HttpOnly_"
+
+// Jar is a cookie jar that can be loaded from and saved to a Netscape cookies.txt file
+// Cookies are matched to requests by net/http/cookiejar, the jar additionally keeps the attributes
+// of every cookie, which cookiejar does not expose, to write them back
+type Jar struct {
+	jar     *cookiejar.Jar
+	mutex   sync.Mutex
+	entries map[entryKey]entry
+}
+
+type entryKey struct {
+	domain string
+	path   string
+	name   string
+}
+
+type entry struct {
+	includeSubdomains bool
+	secure            bool
+	httpOnly          bool
+	// expires is zero for session cookies
+	expires time.Time
+	value   string
+}
+
+// New returns an empty jar
+func New() *Jar {
+	jar, _ := cookiejar.New(nil)
+	return &Jar{jar: jar, entries: make(map[entryKey]entry)}
+}
+
+// Load reads a Netscape cookies.txt file into a new jar, expired cookies are dropped
+func Load(filename string) (*Jar, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("error opening cookies file: %w", err)
+	}
+	defer file.Close()
+
+	j := New()
+	now := time.Now()
+
+	scanner := bufio.NewScanner(file)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+
+		httpOnly := strings.HasPrefix(line, httpOnlyPrefix)
+		line = strings.TrimPrefix(line, httpOnlyPrefix)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		key, e, err := parseLine(line)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing cookies file line %d: %w", lineNumber, err)
+		}
+		e.httpOnly = httpOnly
+
+		if !e.expires.IsZero() && e.expires.Before(now) {
+			continue
+		}
+
+		j.add(key, e)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading cookies file: %w", err)
+	}
+
+	return j, nil
+}
+
+// parseLine parses the tab separated fields domain, include subdomains, path, secure, expiry, name and value
+func parseLine(line string) (entryKey, entry, error) {
+	fields := strings.Split(line, "\t")
+	if len(fields) == 6 {
+		// cookies with an empty value may lose the trailing tab
+		fields = append(fields, "")
+	}
+	if len(fields) != 7 {
+		return entryKey{}, entry{}, fmt.Errorf("expected 7 tab separated fields, got %d", len(fields))
+	}
+
+	expiry, err := strconv.ParseInt(fields[4], 10, 64)
+	if err != nil {
+		return entryKey{}, entry{}, fmt.Errorf("invalid expiry %q: %w", fields[4], err)
+	}
+
+	key := entryKey{
+		domain: strings.ToLower(strings.TrimPrefix(fields[0], ".")),
+		path:   fields[2],
+		name:   fields[5],
+	}
+	e := entry{
+		includeSubdomains: strings.EqualFold(fields[1], "TRUE"),
+		secure:            strings.EqualFold(fields[3], "TRUE"),
+		value:             fields[6],
+	}
+	if expiry > 0 {
+		e.expires = time.Unix(expiry, 0)
+	}
+
+	return key, e, nil
+}
+
+// add records the cookie and passes it to the underlying jar
+func (j *Jar) add(key entryKey, e entry) {
+	j.entries[key] = e
+
+	scheme := "http"
+	if e.secure {
+		scheme = "https"
+	}
+	u := &url.URL{Scheme: scheme, Host: key.domain, Path: key.path}
+
+	cookie := &http.Cookie{
+		Name:     key.name,
+		Value:    e.value,
+		Path:     key.path,
+		Secure:   e.secure,
+		HttpOnly: e.httpOnly,
+		Expires:  e.expires,
+	}
+	if e.includeSubdomains {
+		cookie.Domain = key.domain
+	}
+
+	j.jar.SetCookies(u, []*http.Cookie{cookie})
+}
+
+// Cookies implements http.CookieJar
+func (j *Jar) Cookies(u *url.URL) []*http.Cookie {
+	return j.jar.Cookies(u)
+}
+
+// SetCookies implements http.CookieJar, the cookies set by responses are recorded to be saved
+func (j *Jar) SetCookies(u *url.URL, cookies []*http.Cookie) {
+	j.jar.SetCookies(u, cookies)
+
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	now := time.Now()
+	for _, c := range cookies {
+		key := entryKey{domain: strings.ToLower(u.Hostname()), path: c.Path, name: c.Name}
+		e := entry{secure: c.Secure, httpOnly: c.HttpOnly, value: c.Value}
+
+		if c.Domain != "" {
+			key.domain = strings.ToLower(strings.TrimPrefix(c.Domain, "."))
+			e.includeSubdomains = true
+		}
+		if !strings.HasPrefix(key.path, "/") {
+			key.path = defaultPath(u.Path)
+		}
+
+		switch {
+		case c.MaxAge < 0:
+			delete(j.entries, key)
+			continue
+		case c.MaxAge > 0:
+			e.expires = now.Add(time.Duration(c.MaxAge) * time.Second)
+		case !c.Expires.IsZero():
+			e.expires = c.Expires
+		}
+
+		if !e.expires.IsZero() && e.expires.Before(now) {
+			delete(j.entries, key)
+			continue
+		}
+
+		j.entries[key] = e
+	}
+}
+
+// defaultPath returns the default cookie path of a request path as defined in RFC 6265 section 5.1.4
+func defaultPath(p string) string {
+	if p == "" || p[0] != '/' {
+		return "/"
+	}
+
+	dir := path.Dir(p)
+	if dir == "." {
+		return "/"
+	}
+
+	return dir
+}
+
+// Save writes the cookies that have not expired to a Netscape cookies.txt file
+// The file is written to a temporary file first, so a crash never leaves a truncated file
+func (j *Jar) Save(filename string) error {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	keys := make([]entryKey, 0, len(j.entries))
+	for key := range j.entries {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(a, b int) bool {
+		if keys[a].domain != keys[b].domain {
+			return keys[a].domain < keys[b].domain
+		}
+		if keys[a].path != keys[b].path {
+			return keys[a].path < keys[b].path
+		}
+		return keys[a].name < keys[b].name
+	})
+
+	var b strings.Builder
+	b.WriteString("# Netscape HTTP Cookie File\n")
+
+	now := time.Now()
+	for _, key := range keys {
+		e := j.entries[key]
+		if !e.expires.IsZero() && e.expires.Before(now) {
+			continue
+		}
+
+		domain := key.domain
+		if e.includeSubdomains {
+			domain = "." + domain
+		}
+		if e.httpOnly {
+			domain = httpOnlyPrefix + domain
+		}
+
+		var expiry int64
+		if !e.expires.IsZero() {
+			expiry = e.expires.Unix()
+		}
+
+		fmt.Fprintf(&b, "%s\t%s\t%s\t%s\t%d\t%s\t%s\n",
+			domain, netscapeBool(e.includeSubdomains), key.path, netscapeBool(e.secure), expiry, key.name, e.value)
+	}
+
+	tmpFilename := filename + ".tmp"
+	if err := os.WriteFile(tmpFilename, []byte(b.String()), 0600); err != nil {
+		return fmt.Errorf("error writing cookies file: %w", err)
+	}
+
+	if err := os.Rename(tmpFilename, filename); err != nil {
+		return fmt.Errorf("error writing cookies file: %w", err)
+	}
+
+	return nil
+}
+
+func netscapeBool(b bool) string {
+	if b {
+		return "TRUE"
+	}
+	return "FALSE"
+}
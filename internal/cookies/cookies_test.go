@@ -0,0 +1,103 @@
+package cookies
+
+import (
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+const cookiesFile = "# Netscape HTTP Cookie File\n" +
+	"# a comment\n" +
+	"\n" +
+	".example.com\tTRUE\t/\tFALSE\t4102444800\tlang\ten\n" +
+	"#HttpOnly_.example.com\tTRUE\t/\tTRUE\t4102444800\tsession_id\tabc123\n" +
+	"video.example.com\tFALSE\t/watch\tFALSE\t0\ttemp\tsession\n" +
+	"video.example.com\tFALSE\t/\tFALSE\t4102444800\tempty\n" +
+	"video.example.com\tFALSE\t/\tFALSE\t4102444800\ttracking\tx\n" +
+	"old.example.com\tFALSE\t/\tFALSE\t946684800\texpired\tgone\n"
+
+func TestLoadSaveRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "cookies.txt")
+	if err := os.WriteFile(filename, []byte(cookiesFile), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	jar, err := Load(filename)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	watch, _ := url.Parse("https://video.example.com/watch")
+	if got := cookieNames(jar.Cookies(watch)); got != "empty lang session_id temp tracking" {
+		t.Errorf("Cookies() = %s, want empty lang session_id temp tracking", got)
+	}
+
+	// a response deleting a loaded cookie removes it from the saved file
+	jar.SetCookies(watch, []*http.Cookie{{Name: "tracking", Path: "/", MaxAge: -1}})
+
+	if err := jar.Save(filename); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := "# Netscape HTTP Cookie File\n" +
+		".example.com\tTRUE\t/\tFALSE\t4102444800\tlang\ten\n" +
+		"#HttpOnly_.example.com\tTRUE\t/\tTRUE\t4102444800\tsession_id\tabc123\n" +
+		"video.example.com\tFALSE\t/\tFALSE\t4102444800\tempty\t\n" +
+		"video.example.com\tFALSE\t/watch\tFALSE\t0\ttemp\tsession\n"
+	if string(data) != want {
+		t.Errorf("Save() wrote\n%s\nwant\n%s", data, want)
+	}
+
+	// the saved file loads back to the same cookies
+	reloaded, err := Load(filename)
+	if err != nil {
+		t.Fatalf("Load() of the saved file error = %v", err)
+	}
+	if got := cookieNames(reloaded.Cookies(watch)); got != "empty lang session_id temp" {
+		t.Errorf("Cookies() after reloading = %s, want empty lang session_id temp", got)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		line string
+	}{
+		{"too few fields", "example.com\tFALSE\t/\tFALSE\t0\n"},
+		{"too many fields", "example.com\tFALSE\t/\tFALSE\t0\tname\tvalue\textra\n"},
+		{"invalid expiry", "example.com\tFALSE\t/\tFALSE\tnever\tname\tvalue\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filename := filepath.Join(t.TempDir(), "cookies.txt")
+			if err := os.WriteFile(filename, []byte(tt.line), 0600); err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := Load(filename); err == nil || !strings.Contains(err.Error(), "line 1") {
+				t.Errorf("Load() error = %v, want an error on line 1", err)
+			}
+		})
+	}
+}
+
+// cookieNames returns the sorted names of the cookies separated by spaces
+func cookieNames(cookies []*http.Cookie) string {
+	names := make([]string, len(cookies))
+	for i, c := range cookies {
+		names[i] = c.Name
+	}
+	slices.Sort(names)
+	return strings.Join(names, " ")
+}
@@ -1,35 +1,27 @@
 package boomstream
 
 import (
-	"compress/gzip"
 	"context"
-	"crypto/aes"
-	"crypto/cipher"
 	"encoding/base64"
 	"encoding/hex"
-	"encoding/json"
 	"fmt"
 	"github.com/schollz/progressbar/v3"
-	"io"
-	"net/http"
 	"net/url"
-	"omnivorous/internal/ffmpeg"
-	"omnivorous/internal/fscache"
+	"omnivorous/internal/downloaders"
+	"omnivorous/internal/httpclient"
 	"omnivorous/internal/m3u8"
+	"omnivorous/internal/segments"
 	"omnivorous/internal/urlutils"
 	"os"
-	"path"
-	"path/filepath"
 	"strings"
-	"sync"
-	"time"
 )
 
+const host = "play.boomstream.com"
 const xorKey = "bla_bla_bla"
 const configVersion = "1.2.97"
-const maxSimultaneousDownloads = 10
 
-var headers = map[string]string{
+// defaultHeaders imitate the player embedded on otus.ru, embeds on other sites need another Referer
+var defaultHeaders = map[string]string{
 	"Accept":             "*/*",
 	"Accept-Encoding":    "gzip",
 	"Accept-Language":    "ru-RU,ru;q=0.8",
@@ -59,228 +51,174 @@ type config struct {
 	} `json:"meta"`
 }
 
-type downloader struct {
-	config    config
-	chunklist *m3u8.Playlist
-	key       []byte
-	iv        []byte
-	dir       string
+func init() {
+	downloaders.Register(Boomstream{})
 }
 
-func Download(ctx context.Context, url *url.URL) error {
-	boomstreamId := url.Path
+// Boomstream downloads videos embedded with the Boomstream player
+type Boomstream struct{}
 
-	d := downloader{}
+func (Boomstream) Name() string {
+	return "boomstream"
+}
 
-	bar := progressbar.NewOptions64(
-		-1,
-		progressbar.OptionSetDescription("Getting video config"),
-		progressbar.OptionSetWidth(10),
-		progressbar.OptionThrottle(65*time.Millisecond),
-		progressbar.OptionOnCompletion(func() {
-			fmt.Fprint(os.Stderr, "\r")
-		}),
-		progressbar.OptionSpinnerType(14),
-		progressbar.OptionFullWidth(),
-		progressbar.OptionSetRenderBlankState(true),
-	)
+func (Boomstream) Hosts() []string {
+	return []string{host}
+}
 
-	err := d.getConfig(ctx, url)
-	if err != nil {
-		return fmt.Errorf("error getting config: %w", err)
-	}
+func (Boomstream) Match(u *url.URL) bool {
+	return u.Host == host
+}
 
-	bar.Describe("Retrieving video data")
+func (Boomstream) ID(u *url.URL) string {
+	return strings.Trim(u.Path, "/")
+}
 
-	decodedToken, err := decodeString(d.config.MediaData.Token)
-	if err != nil {
-		return fmt.Errorf("error decoding token: %w", err)
-	}
+func (Boomstream) Download(ctx context.Context, u *url.URL, opts downloaders.Options) error {
+	return Download(ctx, u, opts)
+}
 
-	decodedPlaylistUrl, err := decodeString(d.config.MediaData.Links.HLS)
-	if err != nil {
-		return fmt.Errorf("error decoding playlist URL: %w", err)
-	}
+type downloader struct {
+	// client downloads the segments, metadataClient performs all other requests
+	client         *httpclient.Client
+	metadataClient *httpclient.Client
+	config         config
+	playlistUrl    string
+	chunklist      *m3u8.Playlist
+	key            []byte
+	iv             []byte
+}
 
-	master, err := d.getPlaylist(ctx, decodedPlaylistUrl)
-	if err != nil {
-		return fmt.Errorf("error getting master playlist: %w", err)
+func Download(ctx context.Context, url *url.URL, opts downloaders.Options) error {
+	d := downloader{
+		client:         opts.HTTPClient(defaultHeaders),
+		metadataClient: opts.MetadataHTTPClient(defaultHeaders),
 	}
 
-	selectedStream := master.GetBestResolutionStream()
+	bar := downloaders.NewSpinner("Getting video config", "\r")
 
-	d.chunklist, err = d.getPlaylist(ctx, selectedStream.Url)
-	if err != nil {
-		return fmt.Errorf("error getting chunklist: %w", err)
-	}
+	if opts.ListFormats {
+		master, _, err := d.getMaster(ctx, url, bar)
+		if err != nil {
+			return err
+		}
 
-	err = d.getDecryptionKey(ctx, decodedToken)
-	if err != nil {
-		return fmt.Errorf("error getting decryption key: %w", err)
+		bar.Finish()
+		return downloaders.PrintFormats(os.Stdout, master.Streams)
 	}
 
-	d.dir, err = fscache.GetCacheDir("boomstream", boomstreamId)
-	if err != nil {
-		return fmt.Errorf("error getting cache dir: %w", err)
+	if opts.Simulate {
+		return d.simulate(ctx, url, opts, bar)
 	}
 
-	bar.Finish()
-	bar = progressbar.Default(int64(len(d.chunklist.Segments)), "Downloading video")
+	return opts.DownloadSegments(ctx, downloaders.SegmentedDownload{
+		Service: Boomstream{}.Name(),
+		ID:      Boomstream{}.ID(url),
+		Client:  d.client,
+		Prepare: func(ctx context.Context, bar *progressbar.ProgressBar) (*segments.Manifest, error) {
+			return d.prepare(ctx, url, opts.Quality, bar)
+		},
+		Resume: d.resume,
+		Key:    d.segmentKey,
+	}, bar)
+}
 
-	filesList, err := d.downloadSegments(ctx, bar)
+// getMaster gets the config and the master playlist of the video, it also returns the decoded token
+func (d *downloader) getMaster(ctx context.Context, url *url.URL, bar *progressbar.ProgressBar) (*m3u8.Playlist, string, error) {
+	err := d.getConfig(ctx, url)
 	if err != nil {
-		return fmt.Errorf("error downloading video: %w", err)
+		return nil, "", fmt.Errorf("error getting config: %w", err)
 	}
 
-	ffmpegInputFile, err := generateFfmpegInputFile(filesList, d.dir)
+	bar.Describe("Retrieving video data")
 
-	wd, err := os.Getwd()
+	decodedToken, err := decodeString(d.config.MediaData.Token)
 	if err != nil {
-		return fmt.Errorf("error getting working directory: %w", err)
+		return nil, "", fmt.Errorf("error decoding token: %w", err)
 	}
 
-	bar.Finish()
-	bar = progressbar.NewOptions64(
-		-1,
-		progressbar.OptionSetDescription("Saving video"),
-		progressbar.OptionSetWidth(10),
-		progressbar.OptionThrottle(65*time.Millisecond),
-		progressbar.OptionOnCompletion(func() {
-			fmt.Fprint(os.Stderr, "\n")
-		}),
-		progressbar.OptionSpinnerType(14),
-		progressbar.OptionFullWidth(),
-		progressbar.OptionSetRenderBlankState(true),
-	)
-
-	err = ffmpeg.JoinFiles(ffmpegInputFile, filepath.Join(wd, d.config.Meta.Title))
+	decodedPlaylistUrl, err := decodeString(d.config.MediaData.Links.HLS)
 	if err != nil {
-		return fmt.Errorf("error joining files: %w", err)
+		return nil, "", fmt.Errorf("error decoding playlist URL: %w", err)
 	}
 
-	// delete cache
-	err = os.RemoveAll(d.dir)
+	master, err := d.getPlaylist(ctx, decodedPlaylistUrl)
+	if err != nil {
+		return nil, "", fmt.Errorf("error getting master playlist: %w", err)
+	}
+	d.playlistUrl = decodedPlaylistUrl
 
-	bar.Finish()
-	return nil
+	return master, decodedToken, nil
 }
 
-func (d *downloader) downloadSegments(ctx context.Context, bar *progressbar.ProgressBar) ([]string, error) {
-	ctx, cancel := context.WithCancel(ctx)
-	defer cancel()
-
-	fileList := make([]string, len(d.chunklist.Segments))
-	fileListMutex := sync.Mutex{}
-
-	sem := make(chan struct{}, maxSimultaneousDownloads)
-	var wg sync.WaitGroup
-
-	errChan := make(chan error, 1)
-
-	for i, segment := range d.chunklist.Segments {
-		wg.Add(1)
-		sem <- struct{}{}
-
-		go func(i int, segment m3u8.Segment) {
-			defer wg.Done()
-			defer func() { <-sem }()
-
-			filename, err := downloadSegment(ctx, segment, d.dir, d.iv, d.key)
-			if err != nil {
-				select {
-				case errChan <- err:
-					cancel()
-				default:
-				}
-			}
-
-			bar.Add(1)
-
-			fileListMutex.Lock()
-			fileList[i] = filename
-			fileListMutex.Unlock()
-		}(i, segment)
+// simulate prints what would be downloaded, it neither fetches the key nor touches the cache
+func (d *downloader) simulate(ctx context.Context, url *url.URL, opts downloaders.Options, bar *progressbar.ProgressBar) error {
+	master, _, err := d.getMaster(ctx, url, bar)
+	if err != nil {
+		return err
 	}
 
-	go func() {
-		wg.Wait()
-		close(errChan)
-	}()
-
-	if err := <-errChan; err != nil {
-		return nil, err
+	selectedStream, err := master.SelectStream(opts.Quality)
+	if err != nil {
+		return err
 	}
 
-	return fileList, nil
-}
+	bar.Describe("Getting chunklist")
 
-func downloadSegment(ctx context.Context, segment m3u8.Segment, dir string, iv, key []byte) (string, error) {
-	select {
-	case <-ctx.Done():
-		return "", nil
-	default:
-	}
-
-	segmentUrl, err := url.Parse(segment.Url)
+	chunklist, err := d.getPlaylist(ctx, selectedStream.Url)
 	if err != nil {
-		return "", fmt.Errorf("error parsing segment URL: %w", err)
+		return fmt.Errorf("error getting chunklist: %w", err)
 	}
 
-	filename := filepath.Join(dir, path.Base(segmentUrl.Path))
-	if _, err := os.Stat(filename); err == nil {
-		return filename, nil // Already downloaded
-	}
+	bar.Finish()
+
+	info := downloaders.NewInfo(Boomstream{}.Name(), Boomstream{}.ID(url), d.config.Meta.Title, url.String(), d.playlistUrl, master, selectedStream, chunklist)
+	return downloaders.PrintInfo(os.Stdout, info, opts.DumpJSON)
+}
 
-	resp, err := getReq(ctx, segment.Url)
+// prepare gets the chunklist and key of the video and records them in a new manifest
+func (d *downloader) prepare(ctx context.Context, url *url.URL, quality m3u8.Quality, bar *progressbar.ProgressBar) (*segments.Manifest, error) {
+	master, decodedToken, err := d.getMaster(ctx, url, bar)
 	if err != nil {
-		return "", fmt.Errorf("error downloading segment: %w", err)
+		return nil, err
 	}
-	defer resp.Body.Close()
 
-	encSegment, err := io.ReadAll(resp.Body)
+	selectedStream, err := master.SelectStream(quality)
 	if err != nil {
-		return "", fmt.Errorf("error reading segment: %w", err)
+		return nil, err
 	}
 
-	decrSegment, err := aes128cbcDecrypt(encSegment, key, iv)
+	d.chunklist, err = d.getPlaylist(ctx, selectedStream.Url)
 	if err != nil {
-		return "", fmt.Errorf("error decrypting segment: %w", err)
+		return nil, fmt.Errorf("error getting chunklist: %w", err)
 	}
 
-	file, err := os.OpenFile(filename, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	err = d.getDecryptionKey(ctx, decodedToken)
 	if err != nil {
-		return "", fmt.Errorf("error opening file: %w", err)
+		return nil, fmt.Errorf("error getting decryption key: %w", err)
 	}
-	defer file.Close()
 
-	_, err = file.Write(decrSegment)
+	manifest, err := segments.NewManifest(url.String(), d.config.Meta.Title, *selectedStream, d.chunklist)
 	if err != nil {
-		return "", fmt.Errorf("error writing to file: %w", err)
+		return nil, err
 	}
+	manifest.Key = d.key
+	manifest.IV = d.iv
 
-	return filename, nil
+	return manifest, nil
 }
 
-func generateFfmpegInputFile(fileList []string, dir string) (string, error) {
-	lines := make([]string, len(fileList))
-	for i, file := range fileList {
-		lines[i] = fmt.Sprintf("file '%s'", file)
-	}
-
-	content := strings.Join(lines, "\n")
-	filename := filepath.Join(dir, "input.txt")
-
-	file, err := os.OpenFile(filename, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
-	if err != nil {
-		return "", fmt.Errorf("error opening file: %w", err)
-	}
+// resume restores the key of an interrupted download from the manifest
+func (d *downloader) resume(manifest *segments.Manifest) error {
+	d.key = manifest.Key
+	d.iv = manifest.IV
 
-	_, err = file.WriteString(content)
-	if err != nil {
-		return "", fmt.Errorf("error writing to file: %w", err)
-	}
+	return nil
+}
 
-	return filename, nil
+// segmentKey returns the key and IV of the video, all segments share the same ones
+func (d *downloader) segmentKey(context.Context, int, m3u8.Segment) ([]byte, []byte, error) {
+	return d.key, d.iv, nil
 }
 
 func (d *downloader) getConfig(ctx context.Context, url *url.URL) error {
@@ -292,15 +230,9 @@ func (d *downloader) getConfig(ctx context.Context, url *url.URL) error {
 
 	configUrl.RawQuery = query.Encode()
 
-	resp, err := getReq(ctx, configUrl.String())
-	if err != nil {
-		return fmt.Errorf("error getting config: %w", err)
-	}
-	defer resp.Body.Close()
-
 	var data config
-	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
-		return fmt.Errorf("error decoding JSON: %w", err)
+	if err := d.metadataClient.GetJSON(ctx, configUrl.String(), &data); err != nil {
+		return err
 	}
 
 	d.config = data
@@ -308,29 +240,27 @@ func (d *downloader) getConfig(ctx context.Context, url *url.URL) error {
 	return nil
 }
 
-func (d *downloader) getPlaylist(ctx context.Context, url string) (*m3u8.Playlist, error) {
-	// get the master playlist
-	resp, err := getReq(ctx, url)
+func (d *downloader) getPlaylist(ctx context.Context, playlistUrl string) (*m3u8.Playlist, error) {
+	base, err := url.Parse(playlistUrl)
 	if err != nil {
-		return nil, fmt.Errorf("error getting master playlist: %w", err)
+		return nil, fmt.Errorf("error parsing playlist URL: %w", err)
 	}
-	defer resp.Body.Close()
 
-	data, err := io.ReadAll(resp.Body)
+	data, err := d.metadataClient.GetBytes(ctx, playlistUrl)
 	if err != nil {
-		return nil, fmt.Errorf("error reading response body: %w", err)
+		return nil, err
 	}
 
-	playlist, err := m3u8.Parse(string(data))
+	playlist, err := m3u8.ParseWithBase(string(data), base)
 	if err != nil {
-		return nil, fmt.Errorf("error parsing playlist: %w", err)
+		return nil, &httpclient.DecodeError{URL: playlistUrl, Err: fmt.Errorf("error parsing playlist: %w", err)}
 	}
 
 	return playlist, nil
 }
 
 func (d *downloader) getDecryptionKey(ctx context.Context, token string) error {
-	xMediaReady, ok := d.chunklist.Rest["#EXT-X-MEDIA-READY"]
+	xMediaReady, ok := d.chunklist.Tag("#EXT-X-MEDIA-READY")
 	if !ok {
 		return fmt.Errorf("cannot find #EXT-X-MEDIA-READY in chunklist")
 	}
@@ -339,17 +269,17 @@ func (d *downloader) getDecryptionKey(ctx context.Context, token string) error {
 	if err != nil {
 		return fmt.Errorf("error decrypting #EXT-X-MEDIA-READY: %w", err)
 	}
-
-	keyUrl := "https://play.boomstream.com/api/process/" + xorEncrypt(decrMediaReady[0:20]+token, xorKey)
-	keyResp, err := getReq(ctx, keyUrl)
-	if err != nil {
-		return fmt.Errorf("error getting key: %w", err)
+	if len(decrMediaReady) < 36 {
+		return fmt.Errorf("#EXT-X-MEDIA-READY is too short")
 	}
-	defer keyResp.Body.Close()
 
-	key, err := io.ReadAll(keyResp.Body)
+	keyUrl := "https://" + host + "/api/process/" + xorEncrypt(decrMediaReady[0:20]+token, xorKey)
+	key, err := d.metadataClient.GetBytes(ctx, keyUrl)
 	if err != nil {
-		return fmt.Errorf("error reading key response: %w", err)
+		return err
+	}
+	if len(key) != 16 {
+		return &httpclient.DecodeError{URL: keyUrl, Err: fmt.Errorf("invalid key length %d", len(key))}
 	}
 
 	iv := []byte(decrMediaReady[20:36])
@@ -398,25 +328,6 @@ func xorEncrypt(sourceText, key string) string {
 	return result
 }
 
-func aes128cbcDecrypt(data, key, iv []byte) ([]byte, error) {
-	aesCipher, err := aes.NewCipher(key)
-	if err != nil {
-		return nil, fmt.Errorf("error creating cipher: %w", err)
-	}
-
-	decrypter := cipher.NewCBCDecrypter(aesCipher, iv)
-	decrypted := make([]byte, len(data))
-	decrypter.CryptBlocks(decrypted, data)
-
-	padding := decrypted[len(decrypted)-1]
-	if int(padding) > len(decrypted) || padding == 0 {
-		return nil, fmt.Errorf("invalid padding")
-	}
-	decrypted = decrypted[:len(decrypted)-int(padding)]
-
-	return decrypted, nil
-}
-
 func decodeString(input string) (string, error) {
 	decodedBytes, err := base64.StdEncoding.DecodeString(input)
 	if err != nil {
@@ -424,30 +335,3 @@ func decodeString(input string) (string, error) {
 	}
 	return string(decodedBytes), nil
 }
-
-func getReq(ctx context.Context, url string) (*http.Response, error) {
-	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
-	if err != nil {
-		panic(err)
-	}
-	for key, value := range headers {
-		req.Header.Set(key, value)
-	}
-	req.Header.Set("Host", req.Host)
-	client := http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		panic(err)
-	}
-
-	if resp.Header.Get("Content-Encoding") == "gzip" {
-		encodedBody := resp.Body
-		gzipReader, err := gzip.NewReader(encodedBody)
-		if err != nil {
-			return nil, fmt.Errorf("error creating gzip reader: %w", err)
-		}
-		resp.Body = gzipReader
-	}
-
-	return resp, nil
-}
@@ -0,0 +1,137 @@
+package downloaders
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"omnivorous/internal/ffmpeg"
+	"omnivorous/internal/httpclient"
+	"omnivorous/internal/m3u8"
+	"omnivorous/internal/ratelimit"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Options holds the settings shared by all downloaders
+type Options struct {
+	// OutputDir is the directory relative output paths are resolved against
+	OutputDir string
+	// Output is the template of the output path, DefaultOutput is used if it is empty
+	Output string
+	// Collision decides what happens when the output file already exists
+	Collision Collision
+	// Container is the format of the output file, MP4 is used if it is empty
+	Container ffmpeg.Container
+	// Client performs all requests of the download, a default client is used if it is nil
+	Client *httpclient.Client
+	// MetadataClient performs the requests for metadata, playlists and keys, e.g. through a proxy in another region
+	// Client is used if it is nil
+	MetadataClient *httpclient.Client
+	// Limiter limits the download rate of the segments, shared by all downloads, nil means unlimited
+	Limiter *ratelimit.Limiter
+	// Concurrency is the number of simultaneous segment downloads, the maximum with AdaptiveConcurrency
+	Concurrency         int
+	AdaptiveConcurrency bool
+	// Header overrides the default headers of the downloader, an empty value removes a default header
+	Header map[string]string
+	// Quality selects the stream of the master playlist
+	Quality m3u8.Quality
+	// ListFormats prints the available streams instead of downloading
+	ListFormats bool
+	// Simulate prints what would be downloaded instead of downloading
+	Simulate bool
+	// DumpJSON prints the Info of the video as JSON, it is only used with Simulate
+	DumpJSON bool
+}
+
+// HTTPClient returns the client of the options, or a default client, sending the default headers of the downloader
+// The headers of the options override the defaults
+func (o Options) HTTPClient(defaults map[string]string) *httpclient.Client {
+	client := o.Client
+	if client == nil {
+		client = httpclient.New(httpclient.DefaultConfig)
+	}
+
+	return client.WithHeader(o.mergeHeader(defaults))
+}
+
+// MetadataHTTPClient returns the client for metadata, playlist and key requests, sending the default headers of the downloader
+// It is the client returned by HTTPClient unless a metadata client is set
+func (o Options) MetadataHTTPClient(defaults map[string]string) *httpclient.Client {
+	if o.MetadataClient == nil {
+		return o.HTTPClient(defaults)
+	}
+
+	return o.MetadataClient.WithHeader(o.mergeHeader(defaults))
+}
+
+// Downloader downloads videos from a particular site
+type Downloader interface {
+	// Name returns the service name, e.g. "boomstream"
+	Name() string
+	// Hosts returns the hosts supported by the downloader, used for help and error messages
+	Hosts() []string
+	// Match reports whether the downloader can handle the URL
+	Match(u *url.URL) bool
+	// ID returns the id of the video at the URL, it identifies the video in the download archive
+	ID(u *url.URL) string
+	// Download downloads the video at the URL
+	Download(ctx context.Context, u *url.URL, opts Options) error
+}
+
+// ErrNoDownloader is returned by Find when no registered downloader matches the URL
+var ErrNoDownloader = errors.New("no downloader supports this URL")
+
+var (
+	registryMu sync.RWMutex
+	registry   []Downloader
+)
+
+// Register adds a downloader to the registry
+// It is meant to be called from the init function of the downloader package
+func Register(d Downloader) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	for _, r := range registry {
+		if r.Name() == d.Name() {
+			panic("downloaders: Register called twice for " + d.Name())
+		}
+	}
+
+	registry = append(registry, d)
+}
+
+// Find returns the first registered downloader that matches the URL
+func Find(u *url.URL) (Downloader, error) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	for _, d := range registry {
+		if d.Match(u) {
+			return d, nil
+		}
+	}
+
+	return nil, fmt.Errorf("%w (host %q), supported hosts: %s", ErrNoDownloader, u.Host, strings.Join(hosts(), ", "))
+}
+
+// Hosts returns the sorted list of hosts supported by the registered downloaders
+func Hosts() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	return hosts()
+}
+
+func hosts() []string {
+	var hosts []string
+	for _, d := range registry {
+		hosts = append(hosts, d.Hosts()...)
+	}
+	sort.Strings(hosts)
+
+	return hosts
+}
@@ -0,0 +1,49 @@
+package downloaders
+
+import (
+	"fmt"
+	"io"
+	"omnivorous/internal/m3u8"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// PrintFormats prints the streams of a master playlist as a table
+func PrintFormats(w io.Writer, streams []m3u8.Stream) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintln(tw, "RESOLUTION\tBANDWIDTH\tAVG BANDWIDTH\tFRAME RATE\tCODECS")
+	for _, s := range streams {
+		resolution := "audio only"
+		if s.Resolution.Width > 0 {
+			resolution = fmt.Sprintf("%dx%d", s.Resolution.Width, s.Resolution.Height)
+		}
+
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n",
+			resolution,
+			formatBandwidth(s.Bandwidth),
+			formatBandwidth(s.AverageBandwidth),
+			formatFrameRate(s.FrameRate),
+			strings.Join(s.Codecs, ","),
+		)
+	}
+
+	return tw.Flush()
+}
+
+func formatBandwidth(bandwidth int) string {
+	if bandwidth == 0 {
+		return "-"
+	}
+
+	return fmt.Sprintf("%.0fk", float64(bandwidth)/1000)
+}
+
+func formatFrameRate(frameRate float64) string {
+	if frameRate == 0 {
+		return "-"
+	}
+
+	return strconv.FormatFloat(frameRate, 'f', -1, 64)
+}
@@ -0,0 +1,45 @@
+package downloaders
+
+import (
+	"net/http"
+	"net/url"
+)
+
+// DefaultUserAgent is sent by downloaders that do not need to imitate a particular browser
+const DefaultUserAgent = "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/131.0.0.0 Safari/537.36"
+
+// mergeHeader applies the headers of the options to the default headers of a downloader
+// Headers with an empty value remove the default header
+// A Referer without an Origin also replaces a default Origin, as sites check that both belong to the same page
+func (o Options) mergeHeader(defaults map[string]string) map[string]string {
+	header := make(http.Header)
+	for key, value := range defaults {
+		header.Set(key, value)
+	}
+
+	user := make(http.Header)
+	for key, value := range o.Header {
+		user.Set(key, value)
+	}
+
+	if referer := user.Get("Referer"); referer != "" && user.Values("Origin") == nil && header.Get("Origin") != "" {
+		if u, err := url.Parse(referer); err == nil && u.Host != "" {
+			header.Set("Origin", u.Scheme+"://"+u.Host)
+		}
+	}
+
+	for key := range user {
+		if value := user.Get(key); value != "" {
+			header.Set(key, value)
+		} else {
+			header.Del(key)
+		}
+	}
+
+	merged := make(map[string]string, len(header))
+	for key := range header {
+		merged[key] = header.Get(key)
+	}
+
+	return merged
+}
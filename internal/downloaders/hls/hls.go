@@ -0,0 +1,268 @@
+package hls
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/schollz/progressbar/v3"
+	"net/url"
+	"omnivorous/internal/downloaders"
+	"omnivorous/internal/httpclient"
+	"omnivorous/internal/m3u8"
+	"omnivorous/internal/segments"
+	"os"
+	"path"
+	"strings"
+	"sync"
+)
+
+var defaultHeaders = map[string]string{
+	"User-Agent": downloaders.DefaultUserAgent,
+}
+
+func init() {
+	downloaders.Register(HLS{})
+}
+
+// HLS downloads videos from any plain HLS playlist URL
+type HLS struct{}
+
+func (HLS) Name() string {
+	return "hls"
+}
+
+func (HLS) Hosts() []string {
+	return []string{"any host (.m3u8 URLs)"}
+}
+
+func (HLS) Match(u *url.URL) bool {
+	return strings.HasSuffix(strings.ToLower(u.Path), ".m3u8")
+}
+
+func (HLS) ID(u *url.URL) string {
+	return cacheId(u)
+}
+
+func (HLS) Download(ctx context.Context, u *url.URL, opts downloaders.Options) error {
+	return Download(ctx, u, opts)
+}
+
+type downloader struct {
+	// client downloads the segments, metadataClient performs all other requests
+	client         *httpclient.Client
+	metadataClient *httpclient.Client
+
+	// keysMutex guards the map only, keys are downloaded without holding it
+	keysMutex sync.Mutex
+	keys      map[string]*keyEntry
+}
+
+// keyEntry is a key that is downloaded once, done is closed when data or err is set
+type keyEntry struct {
+	done chan struct{}
+	data []byte
+	err  error
+}
+
+func Download(ctx context.Context, u *url.URL, opts downloaders.Options) error {
+	d := downloader{
+		client:         opts.HTTPClient(defaultHeaders),
+		metadataClient: opts.MetadataHTTPClient(defaultHeaders),
+		keys:           make(map[string]*keyEntry),
+	}
+
+	bar := downloaders.NewSpinner("Getting playlist", "\r")
+
+	if opts.ListFormats {
+		playlist, err := d.getPlaylist(ctx, u)
+		if err != nil {
+			return fmt.Errorf("error getting playlist: %w", err)
+		}
+
+		bar.Finish()
+		if !playlist.IsMaster {
+			_, err = fmt.Fprintln(os.Stdout, "Media playlist, the video has a single format")
+			return err
+		}
+
+		return downloaders.PrintFormats(os.Stdout, playlist.Streams)
+	}
+
+	if opts.Simulate {
+		return d.simulate(ctx, u, opts, bar)
+	}
+
+	return opts.DownloadSegments(ctx, downloaders.SegmentedDownload{
+		Service: HLS{}.Name(),
+		ID:      HLS{}.ID(u),
+		Client:  d.client,
+		Prepare: func(ctx context.Context, bar *progressbar.ProgressBar) (*segments.Manifest, error) {
+			return d.prepare(ctx, u, opts.Quality, bar)
+		},
+		Key: d.segmentKey,
+	}, bar)
+}
+
+// prepare gets the media playlist, resolving the variant of a master playlist, and records it in a new manifest
+func (d *downloader) prepare(ctx context.Context, u *url.URL, quality m3u8.Quality, bar *progressbar.ProgressBar) (*segments.Manifest, error) {
+	_, selectedStream, playlist, err := d.resolve(ctx, u, quality, bar)
+	if err != nil {
+		return nil, err
+	}
+
+	var variant m3u8.Stream
+	if selectedStream != nil {
+		variant = *selectedStream
+	}
+
+	return segments.NewManifest(u.String(), title(u), variant, playlist)
+}
+
+// resolve gets the playlist at the URL and, if it is a master playlist, the media playlist of the stream selected by quality
+// master and the selected stream are nil if the URL is a media playlist
+func (d *downloader) resolve(ctx context.Context, u *url.URL, quality m3u8.Quality, bar *progressbar.ProgressBar) (master *m3u8.Playlist, selected *m3u8.Stream, media *m3u8.Playlist, err error) {
+	playlist, err := d.getPlaylist(ctx, u)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("error getting playlist: %w", err)
+	}
+
+	if !playlist.IsMaster {
+		return nil, nil, playlist, nil
+	}
+
+	bar.Describe("Getting chunklist")
+
+	selected, err = playlist.SelectStream(quality)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	// the audio of such a stream is a separate playlist, downloading only the video would give a silent file
+	for _, m := range playlist.Media {
+		if m.Type == m3u8.MediaTypeAudio && m.GroupID == selected.Audio && m.URI != "" {
+			return nil, nil, nil, fmt.Errorf("streams with a separate audio playlist are not supported")
+		}
+	}
+
+	playlistUrl, err := url.Parse(selected.Url)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("error parsing stream URL: %w", err)
+	}
+
+	media, err = d.getPlaylist(ctx, playlistUrl)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("error getting chunklist: %w", err)
+	}
+
+	return playlist, selected, media, nil
+}
+
+// simulate prints what would be downloaded without touching the cache
+func (d *downloader) simulate(ctx context.Context, u *url.URL, opts downloaders.Options, bar *progressbar.ProgressBar) error {
+	master, selected, media, err := d.resolve(ctx, u, opts.Quality, bar)
+	if err != nil {
+		return err
+	}
+
+	bar.Finish()
+
+	info := downloaders.NewInfo(HLS{}.Name(), HLS{}.ID(u), title(u), u.String(), u.String(), master, selected, media)
+	return downloaders.PrintInfo(os.Stdout, info, opts.DumpJSON)
+}
+
+// segmentKey returns the key and IV of the segment, keys may rotate during the playlist
+func (d *downloader) segmentKey(ctx context.Context, _ int, segment m3u8.Segment) ([]byte, []byte, error) {
+	if segment.Key == nil {
+		return nil, nil, nil
+	}
+
+	if segment.Key.Method != m3u8.KeyMethodAES128 {
+		return nil, nil, fmt.Errorf("unsupported encryption method %q", segment.Key.Method)
+	}
+	if segment.Key.KeyFormat != m3u8.KeyFormatIdentity {
+		return nil, nil, fmt.Errorf("unsupported key format %q", segment.Key.KeyFormat)
+	}
+
+	keyData, err := d.getKey(ctx, segment.Key.URI)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return keyData, segment.IV(), nil
+}
+
+// getKey downloads the key once and caches it for the other segments
+// Segments with the same key wait for its download, segments with other keys do not
+func (d *downloader) getKey(ctx context.Context, uri string) ([]byte, error) {
+	d.keysMutex.Lock()
+	entry, ok := d.keys[uri]
+	if !ok {
+		entry = &keyEntry{done: make(chan struct{})}
+		d.keys[uri] = entry
+	}
+	d.keysMutex.Unlock()
+
+	if ok {
+		select {
+		case <-entry.done:
+			return entry.data, entry.err
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	entry.data, entry.err = d.downloadKey(ctx, uri)
+	if entry.err != nil {
+		// a failed download is not cached, the next segment with the key tries again
+		d.keysMutex.Lock()
+		delete(d.keys, uri)
+		d.keysMutex.Unlock()
+	}
+	close(entry.done)
+
+	return entry.data, entry.err
+}
+
+func (d *downloader) downloadKey(ctx context.Context, uri string) ([]byte, error) {
+	keyData, err := d.metadataClient.GetBytes(ctx, uri)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(keyData) != 16 {
+		return nil, &httpclient.DecodeError{URL: uri, Err: fmt.Errorf("invalid key length %d", len(keyData))}
+	}
+
+	return keyData, nil
+}
+
+func (d *downloader) getPlaylist(ctx context.Context, u *url.URL) (*m3u8.Playlist, error) {
+	data, err := d.metadataClient.GetBytes(ctx, u.String())
+	if err != nil {
+		return nil, err
+	}
+
+	playlist, err := m3u8.ParseWithBase(string(data), u)
+	if err != nil {
+		return nil, &httpclient.DecodeError{URL: u.String(), Err: fmt.Errorf("error parsing playlist: %w", err)}
+	}
+
+	return playlist, nil
+}
+
+// cacheId returns a stable cache directory name for the playlist URL
+func cacheId(u *url.URL) string {
+	sum := sha256.Sum256([]byte(u.String()))
+	return hex.EncodeToString(sum[:8])
+}
+
+// title returns the output file name derived from the playlist URL
+func title(u *url.URL) string {
+	name := strings.TrimSuffix(path.Base(u.Path), path.Ext(u.Path))
+	if name == "" || name == "." || name == "/" {
+		return "video"
+	}
+
+	return name
+}
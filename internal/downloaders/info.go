@@ -0,0 +1,117 @@
+package downloaders
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"omnivorous/internal/m3u8"
+	"strings"
+	"time"
+)
+
+// Info describes what a download would fetch, its JSON form is a stable schema for scripts
+type Info struct {
+	Service string `json:"service"`
+	ID      string `json:"id"`
+	Title   string `json:"title"`
+	URL     string `json:"url"`
+	// PlaylistURL is the master playlist, or the media playlist if the video has a single variant
+	PlaylistURL string    `json:"playlist_url"`
+	Variants    []Variant `json:"variants"`
+	// Selected is the variant chosen by the quality options, nil if the video has a single variant
+	Selected     *Variant `json:"selected"`
+	SegmentCount int      `json:"segment_count"`
+	// Duration is the total duration of the segments in seconds
+	Duration float64 `json:"duration"`
+	// EstimatedSize is the size in bytes estimated from the bandwidth of the selected variant, 0 if it is unknown
+	EstimatedSize int64 `json:"estimated_size"`
+}
+
+// Variant is a stream of the master playlist
+type Variant struct {
+	URL              string   `json:"url"`
+	Width            int      `json:"width"`
+	Height           int      `json:"height"`
+	Bandwidth        int      `json:"bandwidth"`
+	AverageBandwidth int      `json:"average_bandwidth"`
+	FrameRate        float64  `json:"frame_rate"`
+	Codecs           []string `json:"codecs"`
+}
+
+// NewInfo describes the media playlist of the selected stream
+// master and selected are nil if the video has a single variant
+func NewInfo(service, id, title, url, playlistUrl string, master *m3u8.Playlist, selected *m3u8.Stream, media *m3u8.Playlist) Info {
+	info := Info{
+		Service:      service,
+		ID:           id,
+		Title:        title,
+		URL:          url,
+		PlaylistURL:  playlistUrl,
+		Variants:     []Variant{},
+		SegmentCount: len(media.Segments),
+	}
+
+	if master != nil {
+		for _, s := range master.Streams {
+			info.Variants = append(info.Variants, newVariant(s))
+		}
+	}
+
+	var duration time.Duration
+	for _, segment := range media.Segments {
+		duration += segment.Duration
+	}
+	info.Duration = duration.Seconds()
+
+	if selected != nil {
+		variant := newVariant(*selected)
+		info.Selected = &variant
+
+		bandwidth := selected.AverageBandwidth
+		if bandwidth == 0 {
+			bandwidth = selected.Bandwidth
+		}
+		info.EstimatedSize = int64(float64(bandwidth) / 8 * info.Duration)
+	}
+
+	return info
+}
+
+func newVariant(s m3u8.Stream) Variant {
+	codecs := s.Codecs
+	if codecs == nil {
+		codecs = []string{}
+	}
+
+	return Variant{
+		URL:              s.Url,
+		Width:            s.Resolution.Width,
+		Height:           s.Resolution.Height,
+		Bandwidth:        s.Bandwidth,
+		AverageBandwidth: s.AverageBandwidth,
+		FrameRate:        s.FrameRate,
+		Codecs:           codecs,
+	}
+}
+
+// PrintInfo prints the info as a single line of JSON or as a human readable summary
+func PrintInfo(w io.Writer, info Info, asJSON bool) error {
+	if asJSON {
+		return json.NewEncoder(w).Encode(info)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Title:     %s\n", info.Title)
+	fmt.Fprintf(&b, "Service:   %s (%s)\n", info.Service, info.ID)
+	fmt.Fprintf(&b, "Playlist:  %s\n", info.PlaylistURL)
+	if info.Selected != nil {
+		fmt.Fprintf(&b, "Variant:   %dx%d, %s of %d\n", info.Selected.Width, info.Selected.Height, formatBandwidth(info.Selected.Bandwidth), len(info.Variants))
+	}
+	fmt.Fprintf(&b, "Segments:  %d, %s\n", info.SegmentCount, time.Duration(info.Duration*float64(time.Second)).Round(time.Second))
+	if info.EstimatedSize > 0 {
+		fmt.Fprintf(&b, "Size:      ~%.1f MB\n", float64(info.EstimatedSize)/1e6)
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
@@ -0,0 +1,200 @@
+package downloaders
+
+import (
+	"errors"
+	"fmt"
+	"omnivorous/internal/m3u8"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// DefaultOutput is the output template used when none is configured
+const DefaultOutput = "{title}.{ext}"
+
+// maxNameLength keeps file names below the 255 byte limit of common file systems
+const maxNameLength = 200
+
+// ErrSkipped is returned by downloads that were skipped, e.g. because the output file exists
+var ErrSkipped = errors.New("skipped")
+
+// Collision decides what happens when the output file already exists
+type Collision int
+
+const (
+	// CollisionNumber appends a number to the file name, e.g. "title (1).mp4"
+	CollisionNumber Collision = iota
+	// CollisionSkip skips the download
+	CollisionSkip
+	// CollisionOverwrite replaces the existing file
+	CollisionOverwrite
+)
+
+// ParseCollision parses the name of a collision policy
+func ParseCollision(name string) (Collision, error) {
+	switch name {
+	case "number":
+		return CollisionNumber, nil
+	case "skip":
+		return CollisionSkip, nil
+	case "overwrite":
+		return CollisionOverwrite, nil
+	}
+
+	return 0, fmt.Errorf("unknown collision policy %q, expected number, skip or overwrite", name)
+}
+
+// OutputInfo holds the values of the output template fields
+type OutputInfo struct {
+	Title      string
+	ID         string
+	Resolution m3u8.Resolution
+	Date       time.Time
+	Ext        string
+}
+
+// OutputPath expands the output template with info and resolves collisions with existing files
+// Relative paths are relative to the output dir, missing directories are created
+// It returns an error wrapping ErrSkipped if the file exists and collisions are skipped
+func (o Options) OutputPath(info OutputInfo) (string, error) {
+	template := o.Output
+	if template == "" {
+		template = DefaultOutput
+	}
+
+	name, err := expandTemplate(template, info)
+	if err != nil {
+		return "", err
+	}
+
+	output := filepath.Clean(name)
+	if !filepath.IsAbs(output) {
+		output = filepath.Join(o.OutputDir, output)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(output), 0755); err != nil {
+		return "", fmt.Errorf("error creating output dir: %w", err)
+	}
+
+	if !exists(output) {
+		return output, nil
+	}
+
+	switch o.Collision {
+	case CollisionSkip:
+		return "", fmt.Errorf("%w: %s already exists", ErrSkipped, output)
+	case CollisionOverwrite:
+		return output, nil
+	}
+
+	ext := filepath.Ext(output)
+	base := strings.TrimSuffix(output, ext)
+	for i := 1; ; i++ {
+		numbered := fmt.Sprintf("%s (%d)%s", base, i, ext)
+		if !exists(numbered) {
+			return numbered, nil
+		}
+	}
+}
+
+// expandTemplate replaces the {field} placeholders of the template, the values are sanitized to be valid file names
+func expandTemplate(template string, info OutputInfo) (string, error) {
+	var b strings.Builder
+
+	rest := template
+	for {
+		start := strings.IndexByte(rest, '{')
+		if start < 0 {
+			b.WriteString(rest)
+			break
+		}
+
+		end := strings.IndexByte(rest[start:], '}')
+		if end < 0 {
+			return "", fmt.Errorf("unterminated field in output template %q", template)
+		}
+		end += start
+
+		value, err := templateField(rest[start+1:end], info)
+		if err != nil {
+			return "", err
+		}
+
+		b.WriteString(rest[:start])
+		b.WriteString(SanitizeFilename(value))
+		rest = rest[end+1:]
+	}
+
+	return b.String(), nil
+}
+
+func templateField(field string, info OutputInfo) (string, error) {
+	switch field {
+	case "title":
+		return info.Title, nil
+	case "id":
+		return info.ID, nil
+	case "resolution":
+		if info.Resolution.Height == 0 {
+			return "unknown", nil
+		}
+		return fmt.Sprintf("%dx%d", info.Resolution.Width, info.Resolution.Height), nil
+	case "date":
+		return info.Date.Format(time.DateOnly), nil
+	case "ext":
+		return info.Ext, nil
+	}
+
+	return "", fmt.Errorf("unknown field {%s} in output template", field)
+}
+
+// SanitizeFilename turns s into a name that is valid on common file systems
+// Path separators, control and reserved characters are replaced, reserved Windows device names are prefixed
+func SanitizeFilename(s string) string {
+	s = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) || strings.ContainsRune(`/\<>:"|?*`, r) {
+			return '_'
+		}
+		return r
+	}, s)
+
+	// Windows drops trailing dots and spaces
+	s = strings.TrimRight(strings.TrimSpace(s), ".")
+
+	if len(s) > maxNameLength {
+		s = strings.ToValidUTF8(s[:maxNameLength], "")
+	}
+
+	if s == "" {
+		return "_"
+	}
+
+	if isReservedName(s) {
+		return "_" + s
+	}
+
+	return s
+}
+
+// isReservedName reports whether the name is a Windows device name, which is reserved with any extension
+func isReservedName(name string) bool {
+	base, _, _ := strings.Cut(strings.ToUpper(name), ".")
+
+	switch base {
+	case "CON", "PRN", "AUX", "NUL":
+		return true
+	}
+
+	if len(base) == 4 && (strings.HasPrefix(base, "COM") || strings.HasPrefix(base, "LPT")) {
+		return base[3] >= '1' && base[3] <= '9'
+	}
+
+	return false
+}
+
+func exists(name string) bool {
+	_, err := os.Stat(name)
+	return err == nil
+}
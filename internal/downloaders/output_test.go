@@ -0,0 +1,163 @@
+package downloaders
+
+import (
+	"errors"
+	"omnivorous/internal/m3u8"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+func TestExpandTemplate(t *testing.T) {
+	info := OutputInfo{
+		Title:      "Lecture 1: Intro",
+		ID:         "abc123",
+		Resolution: m3u8.Resolution{Width: 1280, Height: 720},
+		Date:       time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC),
+		Ext:        "mp4",
+	}
+
+	tests := []struct {
+		name     string
+		template string
+		want     string
+		err      string
+	}{
+		{"default", DefaultOutput, "Lecture 1_ Intro.mp4", ""},
+		{"all fields", "{date}/{id}-{resolution}.{ext}", "2024-05-01/abc123-1280x720.mp4", ""},
+		{"literal path separators are kept", "videos/{title}.{ext}", "videos/Lecture 1_ Intro.mp4", ""},
+		{"unknown field", "{title}.{format}", "", "unknown field {format}"},
+		{"unterminated field", "{title.{ext}", "", "unknown field"},
+		{"unterminated last field", "{title}.{ext", "", "unterminated field"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := expandTemplate(tt.template, info)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("expandTemplate(%q) = %q, %v, want an error containing %q", tt.template, got, err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expandTemplate(%q) error = %v", tt.template, err)
+			}
+			if got != tt.want {
+				t.Errorf("expandTemplate(%q) = %q, want %q", tt.template, got, tt.want)
+			}
+		})
+	}
+
+	if got, _ := expandTemplate("{resolution}", OutputInfo{}); got != "unknown" {
+		t.Errorf("expandTemplate() of a missing resolution = %q, want unknown", got)
+	}
+}
+
+func TestSanitizeFilename(t *testing.T) {
+	tests := []struct {
+		name string
+		s    string
+		want string
+	}{
+		{"plain", "My video", "My video"},
+		{"path separators", "a/b\\c", "a_b_c"},
+		{"parent dir", "..", "_"},
+		{"parent dir in a path", "../../etc/passwd", ".._.._etc_passwd"},
+		{"reserved characters", `what? <now> "a:b|c*"`, "what_ _now_ _a_b_c__"},
+		{"control characters", "line\nbreak\ttab\x00", "line_break_tab_"},
+		{"trailing dots and spaces", "  title. . ", "title. "},
+		{"empty", "", "_"},
+		{"reserved name", "CON", "_CON"},
+		{"reserved name with extension", "com1.txt", "_com1.txt"},
+		{"reserved name lower case", "nul", "_nul"},
+		{"not reserved", "CONSOLE", "CONSOLE"},
+		{"not reserved COM0", "COM0", "COM0"},
+		{"unicode", "Лекция 日本", "Лекция 日本"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := SanitizeFilename(tt.s); got != tt.want {
+				t.Errorf("SanitizeFilename(%q) = %q, want %q", tt.s, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSanitizeFilenameTruncatesMultibyteTitles(t *testing.T) {
+	// 3 byte characters, the 200 byte limit falls inside the 67th character
+	got := SanitizeFilename(strings.Repeat("日", 100))
+
+	if !utf8.ValidString(got) {
+		t.Errorf("SanitizeFilename() = %q, want valid UTF-8", got)
+	}
+	if want := strings.Repeat("日", 66); got != want {
+		t.Errorf("SanitizeFilename() is %d bytes, want the %d bytes of 66 whole characters", len(got), len(want))
+	}
+}
+
+func TestOutputPathCollisions(t *testing.T) {
+	info := OutputInfo{Title: "title", Ext: "mp4"}
+
+	tests := []struct {
+		name      string
+		collision Collision
+		existing  []string
+		want      string
+		skipped   bool
+	}{
+		{"new file", CollisionNumber, nil, "title.mp4", false},
+		{"number", CollisionNumber, []string{"title.mp4"}, "title (1).mp4", false},
+		{"number skips taken numbers", CollisionNumber, []string{"title.mp4", "title (1).mp4"}, "title (2).mp4", false},
+		{"skip", CollisionSkip, []string{"title.mp4"}, "", true},
+		{"overwrite", CollisionOverwrite, []string{"title.mp4"}, "title.mp4", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for _, name := range tt.existing {
+				if err := os.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			o := Options{OutputDir: dir, Collision: tt.collision}
+			got, err := o.OutputPath(info)
+			if tt.skipped {
+				if !errors.Is(err, ErrSkipped) {
+					t.Fatalf("OutputPath() = %q, %v, want an error wrapping ErrSkipped", got, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("OutputPath() error = %v", err)
+			}
+			if want := filepath.Join(dir, tt.want); got != want {
+				t.Errorf("OutputPath() = %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestOutputPathCreatesDirs(t *testing.T) {
+	dir := t.TempDir()
+	o := Options{OutputDir: dir, Output: "{id}/{title}.{ext}"}
+
+	got, err := o.OutputPath(OutputInfo{Title: "../escape", ID: "..", Ext: "mkv"})
+	if err != nil {
+		t.Fatalf("OutputPath() error = %v", err)
+	}
+
+	// the fields cannot move the file out of the output dir
+	if want := filepath.Join(dir, "_", ".._escape.mkv"); got != want {
+		t.Errorf("OutputPath() = %q, want %q", got, want)
+	}
+	if _, err := os.Stat(filepath.Dir(got)); err != nil {
+		t.Errorf("output dir was not created: %v", err)
+	}
+}
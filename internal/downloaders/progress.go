@@ -0,0 +1,26 @@
+package downloaders
+
+import (
+	"fmt"
+	"github.com/schollz/progressbar/v3"
+	"os"
+	"time"
+)
+
+// NewSpinner returns an indeterminate progress bar with the given description
+// The spinner and completion, which is printed when the spinner finishes, are written to stderr, so stdout only carries results
+func NewSpinner(description, completion string) *progressbar.ProgressBar {
+	return progressbar.NewOptions64(
+		-1,
+		progressbar.OptionSetWriter(os.Stderr),
+		progressbar.OptionSetDescription(description),
+		progressbar.OptionSetWidth(10),
+		progressbar.OptionThrottle(65*time.Millisecond),
+		progressbar.OptionOnCompletion(func() {
+			fmt.Fprint(os.Stderr, completion)
+		}),
+		progressbar.OptionSpinnerType(14),
+		progressbar.OptionFullWidth(),
+		progressbar.OptionSetRenderBlankState(true),
+	)
+}
@@ -0,0 +1,119 @@
+package downloaders
+
+import (
+	"context"
+	"fmt"
+	"github.com/schollz/progressbar/v3"
+	"omnivorous/internal/fscache"
+	"omnivorous/internal/httpclient"
+	"omnivorous/internal/segments"
+	"os"
+	"time"
+)
+
+// SegmentedDownload is the download of the segments of an HLS media playlist
+// The downloaders of HLS based sites only provide how to get the playlist and the keys
+type SegmentedDownload struct {
+	// Service and ID identify the video, they name its cache dir and fill the output template
+	Service string
+	ID      string
+	// Client downloads the segments
+	Client *httpclient.Client
+	// Prepare gets the media playlist of the stream selected by the quality options and returns a new manifest for it
+	Prepare func(ctx context.Context, bar *progressbar.ProgressBar) (*segments.Manifest, error)
+	// Resume restores the state of an interrupted download from its manifest, it may be nil
+	Resume func(manifest *segments.Manifest) error
+	// Key returns the key of a segment, it may be nil if the segments are not encrypted
+	Key segments.KeyFunc
+}
+
+// DownloadSegments downloads the segments into the cache dir of the video and joins them into the output file
+// An interrupted download of a stream matching the quality options is resumed from the manifest in the cache dir
+// The spinner bar is finished before the segments are downloaded
+func (o Options) DownloadSegments(ctx context.Context, d SegmentedDownload, bar *progressbar.ProgressBar) error {
+	dir, err := fscache.GetCacheDir(d.Service, d.ID)
+	if err != nil {
+		return fmt.Errorf("error getting cache dir: %w", err)
+	}
+
+	manifest, err := segments.LoadManifest(dir)
+	if err != nil {
+		return err
+	}
+
+	// a download started with another quality is not resumed, media playlists have no variant to compare
+	if manifest != nil && manifest.Variant.Url != "" && !o.Quality.Matches(manifest.Variant) {
+		manifest = nil
+	}
+
+	if manifest != nil {
+		bar.Describe("Resuming download")
+
+		if d.Resume != nil {
+			err = d.Resume(manifest)
+		}
+	} else {
+		manifest, err = d.Prepare(ctx, bar)
+	}
+	if err != nil {
+		return err
+	}
+
+	// fresh and resumed downloads both use the playlist of the manifest, so they download the same segments
+	playlist, err := manifest.MediaPlaylist()
+	if err != nil {
+		return err
+	}
+
+	for _, segment := range playlist.Segments {
+		if segment.Map != nil {
+			return fmt.Errorf("fragmented MP4 playlists are not supported")
+		}
+		if _, ok := segment.Tag("#EXT-X-BYTERANGE"); ok {
+			return fmt.Errorf("byte range playlists are not supported")
+		}
+	}
+
+	output, err := o.OutputPath(OutputInfo{
+		Title:      manifest.Title,
+		ID:         d.ID,
+		Resolution: manifest.Variant.Resolution,
+		Date:       time.Now(),
+		Ext:        o.Container.Ext(),
+	})
+	if err != nil {
+		bar.Finish()
+		return err
+	}
+
+	bar.Finish()
+	bar = progressbar.Default(int64(len(playlist.Segments)), "Downloading video")
+
+	filesList, err := segments.Download(ctx, segments.Job{
+		Segments:            playlist.Segments,
+		Dir:                 dir,
+		Client:              d.Client,
+		Key:                 d.Key,
+		Manifest:            manifest,
+		Limiter:             o.Limiter,
+		Concurrency:         o.Concurrency,
+		AdaptiveConcurrency: o.AdaptiveConcurrency,
+	}, bar)
+	if err != nil {
+		return fmt.Errorf("error downloading video: %w", err)
+	}
+
+	bar.Finish()
+	bar = NewSpinner("Saving video", "\n")
+
+	err = segments.Join(ctx, filesList, dir, output, o.Container)
+	if err != nil {
+		return err
+	}
+
+	// delete cache, the video is saved even if this fails
+	os.RemoveAll(dir)
+
+	bar.Finish()
+	return nil
+}
@@ -0,0 +1,54 @@
+package ffmpeg
+
+import "fmt"
+
+// Container is the format of the joined output file
+type Container string
+
+const (
+	// MP4 is written with faststart, so playback can begin before the whole file is loaded
+	MP4 Container = "mp4"
+	MKV Container = "mkv"
+	TS  Container = "ts"
+)
+
+// ParseContainer parses the name of a container, "mpegts" is accepted for TS
+func ParseContainer(name string) (Container, error) {
+	switch name {
+	case "mp4":
+		return MP4, nil
+	case "mkv", "matroska":
+		return MKV, nil
+	case "ts", "mpegts":
+		return TS, nil
+	}
+
+	return "", fmt.Errorf("unknown container %q, expected mp4, mkv or ts", name)
+}
+
+// Ext returns the file extension of the container without the dot, the zero container is MP4
+func (c Container) Ext() string {
+	if c == "" {
+		return string(MP4)
+	}
+
+	return string(c)
+}
+
+// formatName returns the name of the libavformat muxer
+func (c Container) formatName() string {
+	switch c {
+	case MKV:
+		return "matroska"
+	case TS:
+		return "mpegts"
+	}
+
+	return "mp4"
+}
+
+// needsASC reports whether AAC audio must be converted from ADTS to an AudioSpecificConfig,
+// MPEG-TS segments carry ADTS headers, which MP4 and Matroska do not accept
+func (c Container) needsASC() bool {
+	return c.formatName() != "mpegts"
+}
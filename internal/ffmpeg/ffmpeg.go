@@ -2,24 +2,32 @@ package ffmpeg
 
 /*
 #cgo pkg-config: libavcodec libavformat libavutil
+#include <errno.h>
+#include <libavcodec/avcodec.h>
+#include <libavcodec/bsf.h>
 #include <libavformat/avformat.h>
 #include <libavutil/avutil.h>
 #include <libavutil/dict.h>
 #include <stdlib.h>
+
+static const int errEAGAIN = AVERROR(EAGAIN);
+static const int errEOF = AVERROR_EOF;
 */
 import "C"
 import (
+	"context"
 	"fmt"
 	"unsafe"
 )
 
-func JoinFiles(input, output string) error {
+// JoinFiles remuxes the files listed in the concat input file into output without re-encoding
+// It stops with the error of the context once the context is cancelled, leaving an incomplete output behind
+func JoinFiles(ctx context.Context, input, output string, container Container) error {
 	var ret C.int
 
 	//C.av_log_set_level(C.AV_LOG_VERBOSE)
 
 	var fmtCtx *C.AVFormatContext = nil
-	defer C.avformat_free_context(fmtCtx)
 
 	getInStream := func(i C.int) *C.struct_AVStream {
 		return *(**C.struct_AVStream)(unsafe.Pointer(uintptr(unsafe.Pointer(fmtCtx.streams)) + uintptr(i)*unsafe.Sizeof(*fmtCtx.streams)))
@@ -28,7 +36,10 @@ func JoinFiles(input, output string) error {
 	var inputFilename *C.char = C.CString(input)
 	defer C.free(unsafe.Pointer(inputFilename))
 
-	var inputFormat *C.AVInputFormat = C.av_find_input_format(C.CString("concat"))
+	var concatName *C.char = C.CString("concat")
+	defer C.free(unsafe.Pointer(concatName))
+
+	var inputFormat *C.AVInputFormat = C.av_find_input_format(concatName)
 
 	var options *C.struct_AVDictionary = nil
 	defer C.av_dict_free(&options)
@@ -52,11 +63,25 @@ func JoinFiles(input, output string) error {
 	}
 
 	var outputFilename *C.char = C.CString(output)
+	defer C.free(unsafe.Pointer(outputFilename))
 
-	C.avformat_alloc_output_context2(&outputCtx, nil, nil, outputFilename)
+	// the muxer is chosen explicitly, guessing it from the file name fails for names without an extension
+	var formatName *C.char = C.CString(container.formatName())
+	defer C.free(unsafe.Pointer(formatName))
+
+	C.avformat_alloc_output_context2(&outputCtx, nil, formatName, outputFilename)
 	if outputCtx == nil {
 		return fmt.Errorf("could not create output context")
 	}
+	defer C.avformat_free_context(outputCtx)
+
+	// bitstream filters by input stream index, nil for streams that are copied as is
+	filters := make([]*C.AVBSFContext, int(fmtCtx.nb_streams))
+	defer func() {
+		for i := range filters {
+			C.av_bsf_free(&filters[i])
+		}
+	}()
 
 	for i := 0; i < int(fmtCtx.nb_streams); i++ {
 		outStream := C.avformat_new_stream(outputCtx, nil)
@@ -64,7 +89,18 @@ func JoinFiles(input, output string) error {
 			return fmt.Errorf("could not allocate outStream")
 		}
 		inStream := getInStream(C.int(i))
-		if ret = C.avcodec_parameters_copy(outStream.codecpar, inStream.codecpar); ret < 0 {
+		codecpar := inStream.codecpar
+
+		if container.needsASC() && inStream.codecpar.codec_id == C.AV_CODEC_ID_AAC {
+			filter, err := newADTSToASCFilter(inStream)
+			if err != nil {
+				return err
+			}
+			filters[i] = filter
+			codecpar = filter.par_out
+		}
+
+		if ret = C.avcodec_parameters_copy(outStream.codecpar, codecpar); ret < 0 {
 			return fmt.Errorf("could not copy codec parameters, %d", int(ret))
 		}
 		outStream.codecpar.codec_tag = 0
@@ -73,18 +109,26 @@ func JoinFiles(input, output string) error {
 	if ret = C.avio_open(&outputCtx.pb, outputFilename, C.AVIO_FLAG_WRITE); ret < 0 {
 		return fmt.Errorf("could not open output file, %d", int(ret))
 	}
+	defer C.avio_closep(&outputCtx.pb)
 
-	if ret = C.avformat_write_header(outputCtx, nil); ret < 0 {
-		return fmt.Errorf("could not write header, %d", int(ret))
+	var muxerOptions *C.struct_AVDictionary = nil
+	defer C.av_dict_free(&muxerOptions)
+
+	if container.formatName() == "mp4" {
+		// move the moov atom to the beginning of the file once it is written
+		var movflagsKey *C.char = C.CString("movflags")
+		defer C.free(unsafe.Pointer(movflagsKey))
+		var faststart *C.char = C.CString("+faststart")
+		defer C.free(unsafe.Pointer(faststart))
+
+		C.av_dict_set(&muxerOptions, movflagsKey, faststart, 0)
 	}
 
-	var pkt C.AVPacket
-	for {
-		if ret = C.av_read_frame(fmtCtx, &pkt); ret < 0 {
-			C.av_packet_unref(&pkt)
-			break
-		}
+	if ret = C.avformat_write_header(outputCtx, &muxerOptions); ret < 0 {
+		return fmt.Errorf("could not write header, %d", int(ret))
+	}
 
+	writePacket := func(pkt *C.AVPacket) error {
 		inStream := getInStream(pkt.stream_index)
 		outStream := getOutStream(pkt.stream_index)
 
@@ -93,10 +137,67 @@ func JoinFiles(input, output string) error {
 		pkt.duration = C.av_rescale_q(pkt.duration, inStream.time_base, outStream.time_base)
 		pkt.pos = -1
 
-		if ret = C.av_interleaved_write_frame(outputCtx, &pkt); ret < 0 {
+		if ret := C.av_interleaved_write_frame(outputCtx, pkt); ret < 0 {
 			return fmt.Errorf("could not write frame, %d", int(ret))
 		}
+		return nil
+	}
+
+	// filterPacket sends the packet through the filter and writes the filtered packets, a nil packet flushes the filter
+	filterPacket := func(filter *C.AVBSFContext, pkt *C.AVPacket, streamIndex C.int) error {
+		if ret := C.av_bsf_send_packet(filter, pkt); ret < 0 {
+			return fmt.Errorf("could not filter packet, %d", int(ret))
+		}
+
+		var filtered C.AVPacket
+		for {
+			ret := C.av_bsf_receive_packet(filter, &filtered)
+			if ret == C.errEAGAIN || ret == C.errEOF {
+				return nil
+			}
+			if ret < 0 {
+				return fmt.Errorf("could not filter packet, %d", int(ret))
+			}
+
+			filtered.stream_index = streamIndex
+			err := writePacket(&filtered)
+			C.av_packet_unref(&filtered)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	var pkt C.AVPacket
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		if ret = C.av_read_frame(fmtCtx, &pkt); ret < 0 {
+			C.av_packet_unref(&pkt)
+			break
+		}
+
+		var err error
+		if filter := filters[pkt.stream_index]; filter != nil {
+			err = filterPacket(filter, &pkt, pkt.stream_index)
+		} else {
+			err = writePacket(&pkt)
+		}
 		C.av_packet_unref(&pkt)
+		if err != nil {
+			return err
+		}
+	}
+
+	for i, filter := range filters {
+		if filter == nil {
+			continue
+		}
+		if err := filterPacket(filter, nil, C.int(i)); err != nil {
+			return err
+		}
 	}
 
 	if ret = C.av_write_trailer(outputCtx); ret < 0 {
@@ -105,3 +206,33 @@ func JoinFiles(input, output string) error {
 
 	return nil
 }
+
+// newADTSToASCFilter creates an aac_adtstoasc bitstream filter for the stream,
+// it strips the ADTS headers and sets the AudioSpecificConfig as extradata of its output parameters
+func newADTSToASCFilter(stream *C.struct_AVStream) (*C.AVBSFContext, error) {
+	var name *C.char = C.CString("aac_adtstoasc")
+	defer C.free(unsafe.Pointer(name))
+
+	bsf := C.av_bsf_get_by_name(name)
+	if bsf == nil {
+		return nil, fmt.Errorf("could not find aac_adtstoasc bitstream filter")
+	}
+
+	var filter *C.AVBSFContext = nil
+	if ret := C.av_bsf_alloc(bsf, &filter); ret < 0 {
+		return nil, fmt.Errorf("could not allocate bitstream filter, %d", int(ret))
+	}
+
+	if ret := C.avcodec_parameters_copy(filter.par_in, stream.codecpar); ret < 0 {
+		C.av_bsf_free(&filter)
+		return nil, fmt.Errorf("could not copy codec parameters, %d", int(ret))
+	}
+	filter.time_base_in = stream.time_base
+
+	if ret := C.av_bsf_init(filter); ret < 0 {
+		C.av_bsf_free(&filter)
+		return nil, fmt.Errorf("could not initialize bitstream filter, %d", int(ret))
+	}
+
+	return filter, nil
+}
@@ -12,7 +12,7 @@ import (
 func GetCacheDir(service string, id string) (string, error) {
 	cacheDir, err := os.UserCacheDir()
 	if err != nil {
-		slog.Error("Error getting user cache dir", err)
+		slog.Error("Error getting user cache dir", "err", err)
 		return "", fmt.Errorf("error getting user cache dir: %w", err)
 	}
 
@@ -20,7 +20,7 @@ func GetCacheDir(service string, id string) (string, error) {
 
 	err = os.MkdirAll(dir, 0755)
 	if err != nil {
-		slog.Error("Error creating cache dir", err)
+		slog.Error("Error creating cache dir", "err", err)
 		return "", fmt.Errorf("error creating cache dir: %w", err)
 	}
 
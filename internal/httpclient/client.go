@@ -0,0 +1,181 @@
+package httpclient
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"omnivorous/internal/retry"
+	"strconv"
+	"time"
+)
+
+// Client performs GET requests with default headers, status checks and retries
+// A client is safe for concurrent use and reuses connections, one client is meant to be shared by all requests
+type Client struct {
+	client      *http.Client
+	header      http.Header
+	retry       retry.Policy
+	readTimeout time.Duration
+}
+
+// New returns a client with its own transport configured by config
+func New(config Config) *Client {
+	c := NewWithHTTPClient(&http.Client{Transport: newTransport(config), Jar: config.Jar}, config.Retry)
+	c.readTimeout = config.ReadTimeout
+
+	return c
+}
+
+// NewWithHTTPClient returns a client that performs requests with client, e.g. the client of an httptest.Server
+func NewWithHTTPClient(client *http.Client, policy retry.Policy) *Client {
+	return &Client{
+		client: client,
+		header: make(http.Header),
+		retry:  policy,
+	}
+}
+
+// WithHeader returns a copy of the client that also sends the given headers
+// The copy shares the connections of the original client
+func (c *Client) WithHeader(header map[string]string) *Client {
+	clone := *c
+	clone.header = c.header.Clone()
+	for key, value := range header {
+		clone.header.Set(key, value)
+	}
+
+	return &clone
+}
+
+// Retry runs fn with the retry policy of the client
+// It is meant for operations that span more than the request, e.g. reading a large body
+func (c *Client) Retry(ctx context.Context, desc string, fn func() error) error {
+	return c.retry.Do(ctx, desc, fn)
+}
+
+// Fetch performs a single GET request
+// Responses without a 2xx status code are returned as a *StatusError, which is permanent unless the status is retryable
+func (c *Client) Fetch(ctx context.Context, url string) (*http.Response, error) {
+	ctx, cancel := context.WithCancel(ctx)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		cancel()
+		return nil, retry.Permanent(fmt.Errorf("error creating request: %w", err))
+	}
+
+	for key, values := range c.header {
+		req.Header[key] = values
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		cancel()
+		return nil, &NetworkError{URL: url, Err: err}
+	}
+
+	// the body cancels the request context once it is closed
+	resp.Body = newDeadlineBody(resp.Body, c.readTimeout, cancel)
+
+	// the transport only decompresses transparently when it added Accept-Encoding itself
+	if resp.Header.Get("Content-Encoding") == "gzip" && !resp.Uncompressed {
+		gzipReader, err := gzip.NewReader(resp.Body)
+		if err != nil {
+			resp.Body.Close()
+			return nil, &DecodeError{URL: url, Err: fmt.Errorf("error creating gzip reader: %w", err)}
+		}
+		resp.Body = readCloser{Reader: gzipReader, Closer: resp.Body}
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, c.statusError(url, resp)
+	}
+
+	return resp, nil
+}
+
+// GetBytes performs a GET request and returns the whole response body
+// Failures while reading the body are retried like failed requests
+func (c *Client) GetBytes(ctx context.Context, url string) ([]byte, error) {
+	var data []byte
+
+	err := c.retry.Do(ctx, url, func() error {
+		resp, err := c.Fetch(ctx, url)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+
+		data, err = io.ReadAll(resp.Body)
+		if err != nil {
+			return &NetworkError{URL: url, Err: fmt.Errorf("error reading response body: %w", err)}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
+
+// GetJSON performs a GET request and decodes the JSON response into v
+func (c *Client) GetJSON(ctx context.Context, url string, v any) error {
+	data, err := c.GetBytes(ctx, url)
+	if err != nil {
+		return err
+	}
+
+	if err := json.Unmarshal(data, v); err != nil {
+		return &DecodeError{URL: url, Err: err}
+	}
+
+	return nil
+}
+
+func (c *Client) statusError(url string, resp *http.Response) error {
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxBodyExcerpt))
+
+	err := &StatusError{
+		URL:        url,
+		StatusCode: resp.StatusCode,
+		Status:     resp.Status,
+		Body:       excerpt(body),
+		RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After")),
+	}
+
+	if !c.retry.Retryable(resp.StatusCode) {
+		return retry.Permanent(err)
+	}
+
+	return err
+}
+
+// parseRetryAfter parses the Retry-After header, which is either a number of seconds or an HTTP date
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+
+	if date, err := http.ParseTime(value); err == nil {
+		return max(time.Until(date), 0)
+	}
+
+	return 0
+}
+
+// readCloser closes the original body when a decoding reader wraps it
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
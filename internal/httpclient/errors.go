@@ -0,0 +1,82 @@
+package httpclient
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// maxBodyExcerpt is the number of response body bytes kept in a StatusError
+const maxBodyExcerpt = 512
+
+// NetworkError is returned when the request could not be sent or the response could not be read
+type NetworkError struct {
+	URL string
+	Err error
+}
+
+func (e *NetworkError) Error() string {
+	return fmt.Sprintf("request to %s failed: %v", e.URL, e.Err)
+}
+
+func (e *NetworkError) Unwrap() error {
+	return e.Err
+}
+
+// StatusError is returned for responses without a 2xx status code
+type StatusError struct {
+	URL        string
+	StatusCode int
+	Status     string
+	// Body is the beginning of the response body, useful to see error pages
+	Body string
+	// RetryAfter is the delay requested by the Retry-After header, 0 if there is none
+	RetryAfter time.Duration
+}
+
+func (e *StatusError) Error() string {
+	if e.Body == "" {
+		return fmt.Sprintf("%s returned %s", e.URL, e.Status)
+	}
+	return fmt.Sprintf("%s returned %s: %s", e.URL, e.Status, e.Body)
+}
+
+// RetryDelay implements retry.Delayer
+func (e *StatusError) RetryDelay() time.Duration {
+	return e.RetryAfter
+}
+
+// DecodeError is returned when the response body is not in the expected format
+type DecodeError struct {
+	URL string
+	Err error
+}
+
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("cannot decode response from %s: %v", e.URL, e.Err)
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// excerpt returns a single line printable excerpt of the body
+func excerpt(body []byte) string {
+	s := strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) {
+			return ' '
+		}
+		if !unicode.IsPrint(r) {
+			return -1
+		}
+		return r
+	}, string(body))
+
+	s = strings.Join(strings.Fields(s), " ")
+	if len(body) >= maxBodyExcerpt {
+		s += "..."
+	}
+
+	return s
+}
@@ -0,0 +1,148 @@
+package httpclient
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"omnivorous/internal/retry"
+	"os"
+	"sync"
+	"time"
+)
+
+// Config configures the transport shared by all requests of a client
+type Config struct {
+	Retry retry.Policy
+	// DialTimeout limits establishing a TCP connection
+	DialTimeout time.Duration
+	// TLSHandshakeTimeout limits the TLS handshake
+	TLSHandshakeTimeout time.Duration
+	// ResponseHeaderTimeout limits waiting for the response headers after the request is sent
+	ResponseHeaderTimeout time.Duration
+	// IdleConnTimeout closes keep-alive connections unused for this long
+	IdleConnTimeout time.Duration
+	// ReadTimeout aborts a response body that receives no data for this long, 0 disables it
+	ReadTimeout time.Duration
+	// MaxIdleConnsPerHost is the number of keep-alive connections kept per host
+	MaxIdleConnsPerHost int
+	// Jar stores the cookies of all requests made with the client, no cookies are sent or kept if it is nil
+	Jar http.CookieJar
+	// Proxy is the proxy all requests go through, the proxy environment variables are used if it is nil
+	Proxy *url.URL
+}
+
+// DefaultConfig is tuned for many parallel segment downloads from a few hosts
+var DefaultConfig = Config{
+	Retry:                 retry.DefaultPolicy,
+	DialTimeout:           15 * time.Second,
+	TLSHandshakeTimeout:   15 * time.Second,
+	ResponseHeaderTimeout: 30 * time.Second,
+	IdleConnTimeout:       90 * time.Second,
+	ReadTimeout:           60 * time.Second,
+	MaxIdleConnsPerHost:   32,
+}
+
+// ParseProxy parses a proxy URL with the scheme http, https, socks5 or socks5h and optional credentials
+// Host names are always resolved by SOCKS5 proxies, so socks5 behaves like socks5h
+func ParseProxy(rawUrl string) (*url.URL, error) {
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy URL: %w", err)
+	}
+
+	switch u.Scheme {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return nil, fmt.Errorf("unsupported proxy scheme %q, expected http, https, socks5 or socks5h", u.Scheme)
+	}
+
+	if u.Host == "" {
+		return nil, fmt.Errorf("proxy URL %q has no host", rawUrl)
+	}
+
+	return u, nil
+}
+
+func newTransport(config Config) *http.Transport {
+	dialer := &net.Dialer{
+		Timeout:   config.DialTimeout,
+		KeepAlive: 30 * time.Second,
+	}
+
+	proxy := http.ProxyFromEnvironment
+	if config.Proxy != nil {
+		proxy = http.ProxyURL(config.Proxy)
+	}
+
+	return &http.Transport{
+		Proxy:                 proxy,
+		DialContext:           dialer.DialContext,
+		ForceAttemptHTTP2:     true,
+		TLSHandshakeTimeout:   config.TLSHandshakeTimeout,
+		ResponseHeaderTimeout: config.ResponseHeaderTimeout,
+		IdleConnTimeout:       config.IdleConnTimeout,
+		MaxIdleConns:          max(100, config.MaxIdleConnsPerHost),
+		MaxIdleConnsPerHost:   config.MaxIdleConnsPerHost,
+		ExpectContinueTimeout: 1 * time.Second,
+	}
+}
+
+// deadlineBody cancels the request when no data is read for the timeout, a zero timeout disables the deadline
+// Closing the body releases the request context
+type deadlineBody struct {
+	io.ReadCloser
+	timeout time.Duration
+	timer   *time.Timer
+	cancel  context.CancelFunc
+
+	mu       sync.Mutex
+	timedOut bool
+}
+
+func newDeadlineBody(body io.ReadCloser, timeout time.Duration, cancel context.CancelFunc) *deadlineBody {
+	b := &deadlineBody{
+		ReadCloser: body,
+		timeout:    timeout,
+		cancel:     cancel,
+	}
+	if timeout > 0 {
+		b.timer = time.AfterFunc(timeout, func() {
+			b.mu.Lock()
+			b.timedOut = true
+			b.mu.Unlock()
+			cancel()
+		})
+	}
+
+	return b
+}
+
+func (b *deadlineBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if n > 0 && b.timer != nil {
+		b.timer.Reset(b.timeout)
+	}
+
+	if err != nil && err != io.EOF {
+		b.mu.Lock()
+		timedOut := b.timedOut
+		b.mu.Unlock()
+		if timedOut {
+			err = fmt.Errorf("no data received for %s: %w", b.timeout, os.ErrDeadlineExceeded)
+		}
+	}
+
+	return n, err
+}
+
+func (b *deadlineBody) Close() error {
+	if b.timer != nil {
+		b.timer.Stop()
+	}
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
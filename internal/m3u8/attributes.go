@@ -0,0 +1,159 @@
+package m3u8
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// AttributeList is a parsed attribute list of a tag as defined in RFC 8216 section 4.2
+// Values are stored as they appear in the playlist, quoted strings keep their quotes
+type AttributeList map[string]string
+
+// ParseAttributeList parses a comma separated list of NAME=VALUE pairs
+// Commas inside quoted strings do not separate attributes
+func ParseAttributeList(s string) (AttributeList, error) {
+	attrs := make(AttributeList)
+
+	for i := 0; i < len(s); {
+		eq := strings.IndexByte(s[i:], '=')
+		if eq < 0 {
+			return nil, fmt.Errorf("attribute without value at %q", s[i:])
+		}
+
+		name := strings.TrimSpace(s[i : i+eq])
+		if !isAttributeName(name) {
+			return nil, fmt.Errorf("invalid attribute name %q", name)
+		}
+		i += eq + 1
+
+		var value string
+		if i < len(s) && s[i] == '"' {
+			end := strings.IndexByte(s[i+1:], '"')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated quoted string in attribute %s", name)
+			}
+			value = s[i : i+end+2]
+			i += end + 2
+
+			rest := strings.TrimLeft(s[i:], " \t")
+			if rest != "" && rest[0] != ',' {
+				return nil, fmt.Errorf("unexpected characters after quoted string in attribute %s", name)
+			}
+			i = len(s) - len(rest)
+		} else {
+			end := strings.IndexByte(s[i:], ',')
+			if end < 0 {
+				end = len(s) - i
+			}
+			value = strings.TrimSpace(s[i : i+end])
+			i += end
+		}
+
+		if _, ok := attrs[name]; ok {
+			return nil, fmt.Errorf("duplicate attribute %s", name)
+		}
+		attrs[name] = value
+
+		// skip the separating comma
+		if i < len(s) {
+			i++
+		}
+	}
+
+	return attrs, nil
+}
+
+func isAttributeName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, c := range name {
+		if !(c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-') {
+			return false
+		}
+	}
+	return true
+}
+
+// String returns a quoted-string attribute without its quotes
+func (a AttributeList) String(name string) string {
+	value := a[name]
+	if len(value) >= 2 && value[0] == '"' && value[len(value)-1] == '"' {
+		return value[1 : len(value)-1]
+	}
+	return value
+}
+
+// Enum returns an enumerated-string attribute
+func (a AttributeList) Enum(name string) string {
+	return a[name]
+}
+
+// Int returns a decimal-integer attribute, missing attributes are 0
+func (a AttributeList) Int(name string) (int, error) {
+	value, ok := a[name]
+	if !ok {
+		return 0, nil
+	}
+	i, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid integer attribute %s: %w", name, err)
+	}
+	return i, nil
+}
+
+// Float returns a decimal-floating-point attribute, missing attributes are 0
+func (a AttributeList) Float(name string) (float64, error) {
+	value, ok := a[name]
+	if !ok {
+		return 0, nil
+	}
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid float attribute %s: %w", name, err)
+	}
+	return f, nil
+}
+
+// Hex returns a hexadecimal-sequence attribute, missing attributes are nil
+func (a AttributeList) Hex(name string) ([]byte, error) {
+	value, ok := a[name]
+	if !ok {
+		return nil, nil
+	}
+	if len(value) < 2 || value[0] != '0' || (value[1] != 'x' && value[1] != 'X') {
+		return nil, fmt.Errorf("invalid hexadecimal attribute %s: missing 0x prefix", name)
+	}
+	digits := value[2:]
+	if len(digits)%2 != 0 {
+		digits = "0" + digits
+	}
+	b, err := hex.DecodeString(digits)
+	if err != nil {
+		return nil, fmt.Errorf("invalid hexadecimal attribute %s: %w", name, err)
+	}
+	return b, nil
+}
+
+// Resolution returns a decimal-resolution attribute, missing attributes are the zero resolution
+func (a AttributeList) Resolution(name string) (Resolution, error) {
+	value, ok := a[name]
+	if !ok {
+		return Resolution{}, nil
+	}
+	widthStr, heightStr, ok := strings.Cut(value, "x")
+	if !ok {
+		return Resolution{}, fmt.Errorf("invalid resolution attribute %s: %q", name, value)
+	}
+	width, err := strconv.Atoi(widthStr)
+	if err != nil {
+		return Resolution{}, fmt.Errorf("invalid resolution attribute %s: %w", name, err)
+	}
+	height, err := strconv.Atoi(heightStr)
+	if err != nil {
+		return Resolution{}, fmt.Errorf("invalid resolution attribute %s: %w", name, err)
+	}
+	return Resolution{Width: width, Height: height}, nil
+}
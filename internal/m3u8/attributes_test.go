@@ -0,0 +1,146 @@
+package m3u8
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseAttributeList(t *testing.T) {
+	tests := []struct {
+		name string
+		s    string
+		want AttributeList
+	}{
+		{"empty", "", AttributeList{}},
+		{"single", "BANDWIDTH=1280000", AttributeList{"BANDWIDTH": "1280000"}},
+		{
+			"quoted commas",
+			`BANDWIDTH=1280000,CODECS="avc1.4d401f,mp4a.40.2",RESOLUTION=1280x720`,
+			AttributeList{"BANDWIDTH": "1280000", "CODECS": `"avc1.4d401f,mp4a.40.2"`, "RESOLUTION": "1280x720"},
+		},
+		{
+			"quoted equals signs",
+			`METHOD=AES-128,URI="key?id=1&t=2"`,
+			AttributeList{"METHOD": "AES-128", "URI": `"key?id=1&t=2"`},
+		},
+		{
+			"hex value",
+			"METHOD=AES-128,IV=0x0123456789abcdef0123456789ABCDEF",
+			AttributeList{"METHOD": "AES-128", "IV": "0x0123456789abcdef0123456789ABCDEF"},
+		},
+		{
+			"whitespace around separators",
+			` TYPE=AUDIO , NAME="English" ,DEFAULT=YES`,
+			AttributeList{"TYPE": "AUDIO", "NAME": `"English"`, "DEFAULT": "YES"},
+		},
+		{"empty quoted string", `NAME=""`, AttributeList{"NAME": `""`}},
+		{"trailing comma", "BANDWIDTH=1,", AttributeList{"BANDWIDTH": "1"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseAttributeList(tt.s)
+			if err != nil {
+				t.Fatalf("ParseAttributeList() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("ParseAttributeList() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseAttributeListErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		s    string
+		err  string
+	}{
+		{"duplicate name", "BANDWIDTH=1,BANDWIDTH=2", "duplicate attribute BANDWIDTH"},
+		{"duplicate name after quoted string", `URI="a,b",URI="c"`, "duplicate attribute URI"},
+		{"lowercase name", "bandwidth=1", "invalid attribute name"},
+		{"name with underscore", "AVERAGE_BANDWIDTH=1", "invalid attribute name"},
+		{"empty name", "=1", "invalid attribute name"},
+		{"missing value", "BANDWIDTH", "attribute without value"},
+		{"unterminated quoted string", `URI="key.bin`, "unterminated quoted string"},
+		{"characters after quoted string", `URI="key.bin"x,METHOD=AES-128`, "unexpected characters"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseAttributeList(tt.s)
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Fatalf("ParseAttributeList() error = %v, want an error containing %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestAttributeListHex(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    []byte
+		wantErr bool
+	}{
+		{"lowercase prefix", "0x00ff", []byte{0x00, 0xff}, false},
+		{"uppercase prefix", "0X00FF", []byte{0x00, 0xff}, false},
+		{"odd number of digits", "0x1ff", []byte{0x01, 0xff}, false},
+		{"full IV", "0x000000000000000000000000000004d2", append(make([]byte, 14), 0x04, 0xd2), false},
+		{"missing prefix", "00ff", nil, true},
+		{"prefix only", "0x", []byte{}, false},
+		{"invalid digit", "0xzz", nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := AttributeList{"IV": tt.value}.Hex("IV")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Hex() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !bytes.Equal(got, tt.want) {
+				t.Fatalf("Hex() = %x, want %x", got, tt.want)
+			}
+		})
+	}
+
+	if got, err := (AttributeList{}).Hex("IV"); got != nil || err != nil {
+		t.Fatalf("Hex() of a missing attribute = %x, %v, want nil, nil", got, err)
+	}
+}
+
+func TestAttributeListValues(t *testing.T) {
+	attrs, err := ParseAttributeList(`BANDWIDTH=1280000,FRAME-RATE=29.970,RESOLUTION=1280x720,CODECS="avc1.4d401f,mp4a.40.2",HDCP-LEVEL=TYPE-0`)
+	if err != nil {
+		t.Fatalf("ParseAttributeList() error = %v", err)
+	}
+
+	if got, err := attrs.Int("BANDWIDTH"); got != 1280000 || err != nil {
+		t.Errorf("Int() = %d, %v, want 1280000", got, err)
+	}
+	if got, err := attrs.Float("FRAME-RATE"); got != 29.97 || err != nil {
+		t.Errorf("Float() = %v, %v, want 29.97", got, err)
+	}
+	if got, err := attrs.Resolution("RESOLUTION"); got != (Resolution{Width: 1280, Height: 720}) || err != nil {
+		t.Errorf("Resolution() = %v, %v, want 1280x720", got, err)
+	}
+	if got := attrs.String("CODECS"); got != "avc1.4d401f,mp4a.40.2" {
+		t.Errorf("String() = %q, want the value without quotes", got)
+	}
+	if got := attrs.Enum("HDCP-LEVEL"); got != "TYPE-0" {
+		t.Errorf("Enum() = %q, want TYPE-0", got)
+	}
+	if got, err := attrs.Int("AVERAGE-BANDWIDTH"); got != 0 || err != nil {
+		t.Errorf("Int() of a missing attribute = %d, %v, want 0", got, err)
+	}
+
+	invalid := AttributeList{"BANDWIDTH": "fast", "RESOLUTION": "1280"}
+	if _, err := invalid.Int("BANDWIDTH"); err == nil {
+		t.Errorf("Int() of an invalid integer succeeded")
+	}
+	if _, err := invalid.Resolution("RESOLUTION"); err == nil {
+		t.Errorf("Resolution() of an invalid resolution succeeded")
+	}
+}
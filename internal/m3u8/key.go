@@ -0,0 +1,56 @@
+package m3u8
+
+import "fmt"
+
+const (
+	KeyMethodNone      = "NONE"
+	KeyMethodAES128    = "AES-128"
+	KeyMethodSampleAES = "SAMPLE-AES"
+)
+
+// KeyFormatIdentity is the default key format, the URI points to the raw 16 byte key
+const KeyFormatIdentity = "identity"
+
+// Key is an #EXT-X-KEY tag, it applies to all following segments until the next one
+type Key struct {
+	Method            string
+	URI               string
+	IV                []byte
+	KeyFormat         string
+	KeyFormatVersions string
+}
+
+func parseKey(attrsStr string) (*Key, error) {
+	attrs, err := ParseAttributeList(attrsStr)
+	if err != nil {
+		return nil, err
+	}
+
+	k := Key{
+		Method:            attrs.Enum("METHOD"),
+		URI:               attrs.String("URI"),
+		KeyFormat:         attrs.String("KEYFORMAT"),
+		KeyFormatVersions: attrs.String("KEYFORMATVERSIONS"),
+	}
+
+	if k.Method == "" {
+		return nil, fmt.Errorf("key has no METHOD")
+	}
+	if k.Method != KeyMethodNone && k.URI == "" {
+		return nil, fmt.Errorf("%s key has no URI", k.Method)
+	}
+
+	k.IV, err = attrs.Hex("IV")
+	if err != nil {
+		return nil, err
+	}
+	if k.IV != nil && len(k.IV) != 16 {
+		return nil, fmt.Errorf("invalid IV length %d", len(k.IV))
+	}
+
+	if k.KeyFormat == "" {
+		k.KeyFormat = KeyFormatIdentity
+	}
+
+	return &k, nil
+}
@@ -3,20 +3,44 @@ package m3u8
 import (
 	"fmt"
 	"log/slog"
+	"math"
+	"net/url"
 	"strconv"
 	"strings"
 	"time"
 )
 
+// Parse parses a playlist, URIs are kept as they appear in the playlist
 func Parse(data string) (*Playlist, error) {
+	return ParseWithBase(data, nil)
+}
+
+// ParseWithBase parses a playlist downloaded from base
+// All stream, rendition, segment, key and map URIs are resolved against base per RFC 3986
+func ParseWithBase(data string, base *url.URL) (*Playlist, error) {
 	var p Playlist
+	// key and map applied to the following segments
+	var key *Key
+	var initMap *Map
+	// tags without a typed field that apply to the next segment
+	var segmentTags []Tag
+
+	// a playlist starts with #EXTM3U, anything else, e.g. an HTML error page, is not a playlist
+	lines := strings.Split(strings.TrimLeft(data, "\ufeff \t\r\n"), "\n")
+	if strings.TrimSpace(lines[0]) != "#EXTM3U" {
+		return nil, fmt.Errorf("not a playlist, the first line is not #EXTM3U")
+	}
 
-	for _, line := range strings.Split(data, "\n") {
+	for _, line := range lines[1:] {
+		line = strings.TrimRight(line, "\r")
 		if len(line) == 0 {
 			continue
 		}
 		if !strings.HasPrefix(line, "#") {
 			if p.IsMaster {
+				if len(p.Streams) == 0 {
+					return nil, fmt.Errorf("URI line %q without #EXT-X-STREAM-INF", line)
+				}
 				// this is a stream url, add to the last stream
 				lastStream := &p.Streams[len(p.Streams)-1]
 				if lastStream.Url != "" {
@@ -25,6 +49,9 @@ func Parse(data string) (*Playlist, error) {
 				}
 				lastStream.Url = line
 			} else {
+				if len(p.Segments) == 0 {
+					return nil, fmt.Errorf("URI line %q without #EXTINF", line)
+				}
 				// this is a segment url, add to the last segment
 				lastSegment := &p.Segments[len(p.Segments)-1]
 				if lastSegment.Url != "" {
@@ -32,82 +59,245 @@ func Parse(data string) (*Playlist, error) {
 					return nil, fmt.Errorf("segment URL already set")
 				}
 				lastSegment.Url = line
+				lastSegment.Tags = segmentTags
+				segmentTags = nil
 			}
-		} else if strings.HasPrefix(line, "#EXTM3U") {
-			p = Playlist{}
 		} else if strings.HasPrefix(line, "#EXT-X-VERSION") {
 			_, versionStr := splitLine(line)
 			version, err := strconv.Atoi(versionStr)
 			if err != nil {
-				slog.Error("Error parsing version", err, "line", line)
+				slog.Error("Error parsing version", "err", err, "line", line)
 				return nil, err
 			}
 			p.Version = version
+		} else if strings.HasPrefix(line, "#EXT-X-MEDIA-SEQUENCE") {
+			_, sequenceStr := splitLine(line)
+			sequence, err := strconv.Atoi(sequenceStr)
+			if err != nil {
+				slog.Error("Error parsing media sequence", "err", err, "line", line)
+				return nil, err
+			}
+			p.MediaSequence = sequence
+		} else if strings.HasPrefix(line, "#EXT-X-KEY") {
+			_, attrsStr := splitLine(line)
+			k, err := parseKey(attrsStr)
+			if err != nil {
+				slog.Error("Error parsing key", "err", err, "line", line)
+				return nil, err
+			}
+			if k.Method == KeyMethodNone {
+				key = nil
+			} else {
+				key = k
+			}
+		} else if strings.HasPrefix(line, "#EXT-X-MAP") {
+			_, attrsStr := splitLine(line)
+			m, err := parseMap(attrsStr)
+			if err != nil {
+				slog.Error("Error parsing map", "err", err, "line", line)
+				return nil, err
+			}
+			initMap = m
 		} else if strings.HasPrefix(line, "#EXT-X-STREAM-INF") {
 			p.IsMaster = true
-			var s Stream
-			_, attrs := splitLine(line)
-			for _, attr := range strings.Split(attrs, ",") {
-				if strings.HasPrefix(attr, "BANDWIDTH=") {
-					_, bandwidthStr := splitAttr(attr)
-					bandwidth, err := strconv.Atoi(bandwidthStr)
-					if err != nil {
-						slog.Error("Error parsing bandwidth", err, "attr", attr)
-						return nil, err
-					}
-					s.Bandwidth = bandwidth
-				}
-				if strings.HasPrefix(attr, "RESOLUTION=") {
-					_, res := splitAttr(attr)
-					var width, height int
-					_, err := fmt.Fscanf(strings.NewReader(res), "%dx%d", &width, &height)
-					if err != nil {
-						return nil, err
-					}
-					s.Resolution = Resolution{Width: width, Height: height}
-				}
+			_, attrsStr := splitLine(line)
+			s, err := parseStreamInf(attrsStr)
+			if err != nil {
+				slog.Error("Error parsing stream info", "err", err, "line", line)
+				return nil, err
 			}
 			if p.Streams == nil {
 				p.Streams = make([]Stream, 0)
 			}
 			p.Streams = append(p.Streams, s)
+		} else if strings.HasPrefix(line, "#EXT-X-MEDIA:") {
+			p.IsMaster = true
+			_, attrsStr := splitLine(line)
+			m, err := parseMedia(attrsStr)
+			if err != nil {
+				slog.Error("Error parsing media", "err", err, "line", line)
+				return nil, err
+			}
+			p.Media = append(p.Media, m)
+		} else if strings.HasPrefix(line, "#EXT-X-I-FRAME-STREAM-INF") {
+			p.IsMaster = true
+			_, attrsStr := splitLine(line)
+			s, err := parseIFrameStreamInf(attrsStr)
+			if err != nil {
+				slog.Error("Error parsing I-frame stream info", "err", err, "line", line)
+				return nil, err
+			}
+			p.IFrameStreams = append(p.IFrameStreams, s)
 		} else if strings.HasPrefix(line, "#EXTINF") {
 			var s Segment
 			_, attrsStr := splitLine(line)
-			// first attr is duration
-			attrs := strings.Split(attrsStr, ",")
-			duration, err := strconv.ParseFloat(attrs[0], 64)
+			// first attr is duration, the rest of the line is an optional title
+			durationStr, title, _ := strings.Cut(attrsStr, ",")
+			duration, err := strconv.ParseFloat(durationStr, 64)
 			if err != nil {
-				slog.Error("Error parsing duration", err, "line", line)
+				slog.Error("Error parsing duration", "err", err, "line", line)
 				return nil, err
 			}
-			s.Duration = time.Duration(duration*1000) * time.Millisecond
-			if p.Streams == nil {
-				p.Streams = make([]Stream, 0)
-			}
+			s.Duration = time.Duration(math.Round(duration*1000)) * time.Millisecond
+			s.Title = title
+			s.Key = key
+			s.Map = initMap
 			p.Segments = append(p.Segments, s)
 		} else {
-			if p.Rest == nil {
-				p.Rest = make(map[string]string)
-			}
-			if strings.Contains(line, ":") {
-				key, value := splitLine(line)
-				p.Rest[key] = value
+			name, value := splitLine(line)
+			tag := Tag{Name: name, Value: value}
+			// once the segments started, every tag belongs to the following segment
+			if len(p.Segments) > 0 || mediaSegmentTags[name] {
+				segmentTags = append(segmentTags, tag)
 			} else {
-				p.Rest[line] = ""
+				p.Tags = append(p.Tags, tag)
 			}
 		}
 	}
+	p.EndTags = segmentTags
+
+	for i := range p.Segments {
+		p.Segments[i].Sequence = p.MediaSequence + i
+	}
+
+	if base != nil {
+		if err := p.resolve(base); err != nil {
+			return nil, err
+		}
+	}
 
 	return &p, nil
 }
 
-func splitAttr(attr string) (string, string) {
-	parts := strings.Split(attr, "=")
-	return parts[0], parts[1]
+// resolve makes all URIs of the playlist absolute
+func (p *Playlist) resolve(base *url.URL) error {
+	var err error
+
+	for i := range p.Streams {
+		if p.Streams[i].Url, err = resolveUri(base, p.Streams[i].Url); err != nil {
+			return err
+		}
+	}
+	for i := range p.IFrameStreams {
+		if p.IFrameStreams[i].Url, err = resolveUri(base, p.IFrameStreams[i].Url); err != nil {
+			return err
+		}
+	}
+	for i := range p.Media {
+		if p.Media[i].URI, err = resolveUri(base, p.Media[i].URI); err != nil {
+			return err
+		}
+	}
+
+	// keys and maps are shared between segments, resolve each only once
+	keys := make(map[*Key]bool)
+	maps := make(map[*Map]bool)
+
+	for i := range p.Segments {
+		s := &p.Segments[i]
+		if s.Url, err = resolveUri(base, s.Url); err != nil {
+			return err
+		}
+		if s.Key != nil && !keys[s.Key] {
+			keys[s.Key] = true
+			if s.Key.URI, err = resolveUri(base, s.Key.URI); err != nil {
+				return err
+			}
+		}
+		if s.Map != nil && !maps[s.Map] {
+			maps[s.Map] = true
+			if s.Map.URI, err = resolveUri(base, s.Map.URI); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func resolveUri(base *url.URL, uri string) (string, error) {
+	if uri == "" {
+		return "", nil
+	}
+
+	resolved, err := base.Parse(uri)
+	if err != nil {
+		return "", fmt.Errorf("error resolving URI %q: %w", uri, err)
+	}
+
+	return resolved.String(), nil
+}
+
+func parseStreamInf(attrsStr string) (Stream, error) {
+	attrs, err := ParseAttributeList(attrsStr)
+	if err != nil {
+		return Stream{}, err
+	}
+
+	return newStream(attrs)
+}
+
+// parseIFrameStreamInf parses an #EXT-X-I-FRAME-STREAM-INF tag, the URI of the I-frame playlist is an attribute
+func parseIFrameStreamInf(attrsStr string) (Stream, error) {
+	attrs, err := ParseAttributeList(attrsStr)
+	if err != nil {
+		return Stream{}, err
+	}
+
+	s, err := newStream(attrs)
+	if err != nil {
+		return s, err
+	}
+
+	s.Url = attrs.String("URI")
+	if s.Url == "" {
+		return s, fmt.Errorf("I-frame stream has no URI")
+	}
+
+	return s, nil
+}
+
+// newStream returns the stream described by the attributes shared by #EXT-X-STREAM-INF and #EXT-X-I-FRAME-STREAM-INF
+func newStream(attrs AttributeList) (Stream, error) {
+	var s Stream
+	var err error
+
+	if s.Bandwidth, err = attrs.Int("BANDWIDTH"); err != nil {
+		return s, err
+	}
+	if s.AverageBandwidth, err = attrs.Int("AVERAGE-BANDWIDTH"); err != nil {
+		return s, err
+	}
+	if s.Resolution, err = attrs.Resolution("RESOLUTION"); err != nil {
+		return s, err
+	}
+	if s.FrameRate, err = attrs.Float("FRAME-RATE"); err != nil {
+		return s, err
+	}
+	if codecs := attrs.String("CODECS"); codecs != "" {
+		s.Codecs = strings.Split(codecs, ",")
+	}
+	s.HDCPLevel = attrs.Enum("HDCP-LEVEL")
+	s.Audio = attrs.String("AUDIO")
+	s.Video = attrs.String("VIDEO")
+	s.Subtitles = attrs.String("SUBTITLES")
+	s.ClosedCaptions = attrs.String("CLOSED-CAPTIONS")
+
+	for name, value := range attrs {
+		if streamAttributes[name] {
+			continue
+		}
+		if s.Attributes == nil {
+			s.Attributes = make(AttributeList)
+		}
+		s.Attributes[name] = value
+	}
+
+	return s, nil
 }
 
 func splitLine(line string) (string, string) {
-	parts := strings.Split(line, ":")
-	return parts[0], parts[1]
+	// only the first colon separates the tag from its value, values may contain URIs
+	key, value, _ := strings.Cut(line, ":")
+	return key, value
 }
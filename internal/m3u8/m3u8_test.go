@@ -0,0 +1,142 @@
+package m3u8
+
+import (
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseRejectsInvalidPlaylists(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		err  string
+	}{
+		{"empty", "", "not a playlist"},
+		{"html page", "<!DOCTYPE html>\n<html><body>Not found</body></html>\n", "not a playlist"},
+		{"missing header", "seg.ts\n", "not a playlist"},
+		{"header not on the first line", "#EXT-X-VERSION:3\n#EXTM3U\n", "not a playlist"},
+		{"segment URI without #EXTINF", "#EXTM3U\nseg.ts\n", "without #EXTINF"},
+		{"stream URI after #EXT-X-MEDIA", "#EXTM3U\n#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID=\"a\",NAME=\"en\"\nfoo.m3u8\n", "without #EXT-X-STREAM-INF"},
+		{"stream URI after #EXT-X-I-FRAME-STREAM-INF", "#EXTM3U\n#EXT-X-I-FRAME-STREAM-INF:BANDWIDTH=1,URI=\"i.m3u8\"\nfoo.m3u8\n", "without #EXT-X-STREAM-INF"},
+		{"two URIs for one stream", "#EXTM3U\n#EXT-X-STREAM-INF:BANDWIDTH=1\nlow.m3u8\nhigh.m3u8\n", "stream URL already set"},
+		{"two URIs for one segment", "#EXTM3U\n#EXTINF:4,\na.ts\nb.ts\n", "segment URL already set"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(tt.data)
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Fatalf("Parse() error = %v, want an error containing %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestParseAcceptsHeaderVariants(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+	}{
+		{"plain", "#EXTM3U\n#EXTINF:4,\na.ts\n"},
+		{"byte order mark", "\ufeff#EXTM3U\n#EXTINF:4,\na.ts\n"},
+		{"CRLF line endings", "#EXTM3U\r\n#EXTINF:4,\r\na.ts\r\n"},
+		{"leading blank lines", "\n\n#EXTM3U\n#EXTINF:4,\na.ts\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := Parse(tt.data)
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			if len(p.Segments) != 1 || p.Segments[0].Url != "a.ts" {
+				t.Fatalf("Parse() segments = %+v, want a single segment a.ts", p.Segments)
+			}
+		})
+	}
+}
+
+func TestParseWithBaseResolvesURIs(t *testing.T) {
+	base, err := url.Parse("https://cdn.example.com/video/master.m3u8?token=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	master, err := ParseWithBase(`#EXTM3U
+#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="aud",NAME="English",LANGUAGE="en",DEFAULT=YES,AUTOSELECT=YES,URI="audio/en.m3u8"
+#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="aud",NAME="Deutsch",LANGUAGE="de",URI="/audio/de.m3u8"
+#EXT-X-MEDIA:TYPE=CLOSED-CAPTIONS,GROUP-ID="cc",NAME="English",INSTREAM-ID="CC1"
+#EXT-X-STREAM-INF:BANDWIDTH=1280000,RESOLUTION=1280x720,AUDIO="aud",CLOSED-CAPTIONS="cc"
+720p/media.m3u8
+#EXT-X-I-FRAME-STREAM-INF:BANDWIDTH=86000,RESOLUTION=1280x720,URI="720p/iframes.m3u8"
+`, base)
+	if err != nil {
+		t.Fatalf("ParseWithBase() error = %v", err)
+	}
+
+	wantMedia := []Media{
+		{Type: MediaTypeAudio, GroupID: "aud", Name: "English", Language: "en", Default: true, Autoselect: true, URI: "https://cdn.example.com/video/audio/en.m3u8"},
+		{Type: MediaTypeAudio, GroupID: "aud", Name: "Deutsch", Language: "de", URI: "https://cdn.example.com/audio/de.m3u8"},
+		{Type: MediaTypeClosedCaptions, GroupID: "cc", Name: "English", InstreamID: "CC1"},
+	}
+	if !reflect.DeepEqual(master.Media, wantMedia) {
+		t.Errorf("Media = %+v, want %+v", master.Media, wantMedia)
+	}
+	if len(master.Streams) != 1 || master.Streams[0].Url != "https://cdn.example.com/video/720p/media.m3u8" || master.Streams[0].Audio != "aud" {
+		t.Errorf("Streams = %+v, want the 720p stream with an absolute URL", master.Streams)
+	}
+	if len(master.IFrameStreams) != 1 || master.IFrameStreams[0].Url != "https://cdn.example.com/video/720p/iframes.m3u8" {
+		t.Errorf("IFrameStreams = %+v, want the 720p I-frame stream with an absolute URL", master.IFrameStreams)
+	}
+
+	media, err := ParseWithBase(`#EXTM3U
+#EXT-X-MAP:URI="init.mp4"
+#EXT-X-KEY:METHOD=AES-128,URI="../keys/key.bin"
+#EXTINF:4,
+seg0.m4s
+#EXTINF:4,
+https://other.example.com/seg1.m4s
+`, base)
+	if err != nil {
+		t.Fatalf("ParseWithBase() error = %v", err)
+	}
+
+	uris := []struct {
+		name string
+		got  string
+		want string
+	}{
+		{"map", media.Segments[0].Map.URI, "https://cdn.example.com/video/init.mp4"},
+		{"key", media.Segments[0].Key.URI, "https://cdn.example.com/keys/key.bin"},
+		{"relative segment", media.Segments[0].Url, "https://cdn.example.com/video/seg0.m4s"},
+		{"absolute segment", media.Segments[1].Url, "https://other.example.com/seg1.m4s"},
+	}
+	for _, uri := range uris {
+		if uri.got != uri.want {
+			t.Errorf("%s URI = %q, want %q", uri.name, uri.got, uri.want)
+		}
+	}
+}
+
+func TestParseMediaErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		tag  string
+	}{
+		{"missing type", `#EXT-X-MEDIA:GROUP-ID="aud",NAME="English"`},
+		{"missing group id", `#EXT-X-MEDIA:TYPE=AUDIO,NAME="English"`},
+		{"missing name", `#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="aud"`},
+		{"closed captions with URI", `#EXT-X-MEDIA:TYPE=CLOSED-CAPTIONS,GROUP-ID="cc",NAME="English",URI="cc.m3u8"`},
+		{"I-frame stream without URI", `#EXT-X-I-FRAME-STREAM-INF:BANDWIDTH=86000`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Parse("#EXTM3U\n" + tt.tag + "\n"); err == nil {
+				t.Fatalf("Parse() succeeded, want an error")
+			}
+		})
+	}
+}
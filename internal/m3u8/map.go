@@ -0,0 +1,27 @@
+package m3u8
+
+import "fmt"
+
+// Map is an #EXT-X-MAP tag, the media initialization section of the following segments
+type Map struct {
+	URI       string
+	ByteRange string
+}
+
+func parseMap(attrsStr string) (*Map, error) {
+	attrs, err := ParseAttributeList(attrsStr)
+	if err != nil {
+		return nil, err
+	}
+
+	m := Map{
+		URI:       attrs.String("URI"),
+		ByteRange: attrs.String("BYTERANGE"),
+	}
+
+	if m.URI == "" {
+		return nil, fmt.Errorf("map has no URI")
+	}
+
+	return &m, nil
+}
@@ -0,0 +1,233 @@
+package m3u8
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Marshal returns the playlist in the m3u8 format
+func (p *Playlist) Marshal() ([]byte, error) {
+	var buf bytes.Buffer
+	if _, err := p.WriteTo(&buf); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// WriteTo writes the playlist in the m3u8 format to w
+// Tags without a typed field are written where they appeared, the tags of a segment before its key, map and #EXTINF tags
+func (p *Playlist) WriteTo(w io.Writer) (int64, error) {
+	var b strings.Builder
+
+	b.WriteString("#EXTM3U\n")
+	if p.Version > 0 {
+		fmt.Fprintf(&b, "#EXT-X-VERSION:%d\n", p.Version)
+	}
+
+	if !p.IsMaster {
+		if _, ok := p.Tag("#EXT-X-TARGETDURATION"); !ok {
+			fmt.Fprintf(&b, "#EXT-X-TARGETDURATION:%d\n", p.targetDuration())
+		}
+		if p.MediaSequence != 0 {
+			fmt.Fprintf(&b, "#EXT-X-MEDIA-SEQUENCE:%d\n", p.MediaSequence)
+		}
+	}
+
+	writeTags(&b, p.Tags)
+
+	if p.IsMaster {
+		for _, m := range p.Media {
+			fmt.Fprintf(&b, "#EXT-X-MEDIA:%s\n", marshalMedia(m))
+		}
+		for _, s := range p.Streams {
+			if s.Url == "" {
+				return 0, fmt.Errorf("stream has no URL")
+			}
+			fmt.Fprintf(&b, "#EXT-X-STREAM-INF:%s\n%s\n", marshalStreamInf(s), s.Url)
+		}
+		for _, s := range p.IFrameStreams {
+			if s.Url == "" {
+				return 0, fmt.Errorf("I-frame stream has no URL")
+			}
+			fmt.Fprintf(&b, "#EXT-X-I-FRAME-STREAM-INF:%s,URI=%s\n", marshalStreamInf(s), quote(s.Url))
+		}
+	} else {
+		var key *Key
+		var initMap *Map
+		for _, s := range p.Segments {
+			if s.Url == "" {
+				return 0, fmt.Errorf("segment has no URL")
+			}
+			writeTags(&b, s.Tags)
+			if !keysEqual(key, s.Key) {
+				fmt.Fprintf(&b, "#EXT-X-KEY:%s\n", marshalKey(s.Key))
+				key = s.Key
+			}
+			if s.Map != nil && (initMap == nil || *initMap != *s.Map) {
+				fmt.Fprintf(&b, "#EXT-X-MAP:%s\n", marshalMap(s.Map))
+				initMap = s.Map
+			}
+			fmt.Fprintf(&b, "#EXTINF:%s,%s\n%s\n", formatFloat(s.Duration.Seconds()), s.Title, s.Url)
+		}
+	}
+
+	writeTags(&b, p.EndTags)
+
+	n, err := io.WriteString(w, b.String())
+	return int64(n), err
+}
+
+func writeTags(b *strings.Builder, tags []Tag) {
+	for _, tag := range tags {
+		b.WriteString(tag.String())
+		b.WriteString("\n")
+	}
+}
+
+// targetDuration returns the longest segment duration rounded to the nearest integer
+func (p *Playlist) targetDuration() int {
+	var target float64
+	for _, s := range p.Segments {
+		target = math.Max(target, math.Round(s.Duration.Seconds()))
+	}
+
+	return int(target)
+}
+
+func marshalStreamInf(s Stream) string {
+	attrs := []string{"BANDWIDTH=" + strconv.Itoa(s.Bandwidth)}
+	if s.AverageBandwidth != 0 {
+		attrs = append(attrs, "AVERAGE-BANDWIDTH="+strconv.Itoa(s.AverageBandwidth))
+	}
+	if len(s.Codecs) > 0 {
+		attrs = append(attrs, "CODECS="+quote(strings.Join(s.Codecs, ",")))
+	}
+	if s.Resolution.Width != 0 || s.Resolution.Height != 0 {
+		attrs = append(attrs, fmt.Sprintf("RESOLUTION=%dx%d", s.Resolution.Width, s.Resolution.Height))
+	}
+	if s.FrameRate != 0 {
+		attrs = append(attrs, "FRAME-RATE="+strconv.FormatFloat(s.FrameRate, 'f', 3, 64))
+	}
+	if s.HDCPLevel != "" {
+		attrs = append(attrs, "HDCP-LEVEL="+s.HDCPLevel)
+	}
+	if s.Audio != "" {
+		attrs = append(attrs, "AUDIO="+quote(s.Audio))
+	}
+	if s.Video != "" {
+		attrs = append(attrs, "VIDEO="+quote(s.Video))
+	}
+	if s.Subtitles != "" {
+		attrs = append(attrs, "SUBTITLES="+quote(s.Subtitles))
+	}
+	if s.ClosedCaptions == "NONE" {
+		attrs = append(attrs, "CLOSED-CAPTIONS=NONE")
+	} else if s.ClosedCaptions != "" {
+		attrs = append(attrs, "CLOSED-CAPTIONS="+quote(s.ClosedCaptions))
+	}
+
+	// the order of the other attributes is lost, sort them to keep the output stable
+	names := make([]string, 0, len(s.Attributes))
+	for name := range s.Attributes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		attrs = append(attrs, name+"="+s.Attributes[name])
+	}
+
+	return strings.Join(attrs, ",")
+}
+
+func marshalMedia(m Media) string {
+	attrs := []string{"TYPE=" + m.Type, "GROUP-ID=" + quote(m.GroupID), "NAME=" + quote(m.Name)}
+	if m.URI != "" {
+		attrs = append(attrs, "URI="+quote(m.URI))
+	}
+	if m.Language != "" {
+		attrs = append(attrs, "LANGUAGE="+quote(m.Language))
+	}
+	if m.AssocLanguage != "" {
+		attrs = append(attrs, "ASSOC-LANGUAGE="+quote(m.AssocLanguage))
+	}
+	if m.Default {
+		attrs = append(attrs, "DEFAULT=YES")
+	}
+	if m.Autoselect {
+		attrs = append(attrs, "AUTOSELECT=YES")
+	}
+	if m.Forced {
+		attrs = append(attrs, "FORCED=YES")
+	}
+	if m.InstreamID != "" {
+		attrs = append(attrs, "INSTREAM-ID="+quote(m.InstreamID))
+	}
+	if m.Characteristics != "" {
+		attrs = append(attrs, "CHARACTERISTICS="+quote(m.Characteristics))
+	}
+	if m.Channels != "" {
+		attrs = append(attrs, "CHANNELS="+quote(m.Channels))
+	}
+
+	return strings.Join(attrs, ",")
+}
+
+func marshalKey(k *Key) string {
+	if k == nil {
+		return "METHOD=" + KeyMethodNone
+	}
+
+	attrs := []string{"METHOD=" + k.Method}
+	if k.URI != "" {
+		attrs = append(attrs, "URI="+quote(k.URI))
+	}
+	if k.IV != nil {
+		attrs = append(attrs, "IV=0x"+hex.EncodeToString(k.IV))
+	}
+	if k.KeyFormat != "" && k.KeyFormat != KeyFormatIdentity {
+		attrs = append(attrs, "KEYFORMAT="+quote(k.KeyFormat))
+	}
+	if k.KeyFormatVersions != "" {
+		attrs = append(attrs, "KEYFORMATVERSIONS="+quote(k.KeyFormatVersions))
+	}
+
+	return strings.Join(attrs, ",")
+}
+
+func marshalMap(m *Map) string {
+	attrs := []string{"URI=" + quote(m.URI)}
+	if m.ByteRange != "" {
+		attrs = append(attrs, "BYTERANGE="+quote(m.ByteRange))
+	}
+
+	return strings.Join(attrs, ",")
+}
+
+func keysEqual(a, b *Key) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+
+	return a.Method == b.Method &&
+		a.URI == b.URI &&
+		bytes.Equal(a.IV, b.IV) &&
+		a.KeyFormat == b.KeyFormat &&
+		a.KeyFormatVersions == b.KeyFormatVersions
+}
+
+// quote returns a quoted-string attribute value
+func quote(s string) string {
+	return `"` + s + `"`
+}
+
+// formatFloat formats a duration in seconds with up to millisecond precision
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
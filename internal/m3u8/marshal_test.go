@@ -0,0 +1,188 @@
+package m3u8
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+const mediaPlaylist = `#EXTM3U
+#EXT-X-VERSION:4
+#EXT-X-TARGETDURATION:6
+#EXT-X-MEDIA-SEQUENCE:1200
+#EXT-X-PLAYLIST-TYPE:VOD
+#EXT-X-INDEPENDENT-SEGMENTS
+#EXT-X-MEDIA-READY:0a1b2c
+#EXT-X-PROGRAM-DATE-TIME:2024-05-01T10:00:00.000Z
+#EXT-X-KEY:METHOD=AES-128,URI="https://cdn.example.com/key.bin",IV=0x000000000000000000000000000004b0
+#EXTINF:6,intro
+https://cdn.example.com/seg0.ts
+#EXT-X-BYTERANGE:75232@0
+#EXTINF:5.005,
+https://cdn.example.com/seg1.ts
+#EXT-X-DISCONTINUITY
+#EXT-X-KEY:METHOD=NONE
+#EXTINF:6,
+https://cdn.example.com/ad0.ts
+#EXT-X-CUE-OUT:30
+#EXT-X-CUE-IN
+#EXTINF:4.2,
+https://cdn.example.com/seg2.ts
+#EXT-X-ENDLIST
+`
+
+const masterPlaylist = `#EXTM3U
+#EXT-X-VERSION:6
+#EXT-X-INDEPENDENT-SEGMENTS
+#EXT-X-SESSION-DATA:DATA-ID="com.example.title",VALUE="Lecture"
+#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="aud",NAME="English",URI="https://cdn.example.com/audio/en.m3u8",LANGUAGE="en",DEFAULT=YES,AUTOSELECT=YES
+#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="aud",NAME="Deutsch",URI="https://cdn.example.com/audio/de.m3u8",LANGUAGE="de",AUTOSELECT=YES,CHANNELS="2"
+#EXT-X-MEDIA:TYPE=SUBTITLES,GROUP-ID="subs",NAME="English",URI="https://cdn.example.com/subs/en.m3u8",LANGUAGE="en",FORCED=YES
+#EXT-X-MEDIA:TYPE=CLOSED-CAPTIONS,GROUP-ID="cc",NAME="English",INSTREAM-ID="CC1"
+#EXT-X-STREAM-INF:BANDWIDTH=2560000,AVERAGE-BANDWIDTH=2000000,CODECS="avc1.640028,mp4a.40.2",RESOLUTION=1920x1080,FRAME-RATE=30.000,AUDIO="aud",SUBTITLES="subs",CLOSED-CAPTIONS="cc",PROGRAM-ID=1
+https://cdn.example.com/1080p/media.m3u8
+#EXT-X-STREAM-INF:BANDWIDTH=1280000,RESOLUTION=1280x720,AUDIO="aud",SUBTITLES="subs",CLOSED-CAPTIONS=NONE
+https://cdn.example.com/720p/media.m3u8
+#EXT-X-I-FRAME-STREAM-INF:BANDWIDTH=86000,RESOLUTION=1280x720,URI="https://cdn.example.com/720p/iframes.m3u8"
+`
+
+func TestMarshalRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+	}{
+		{"media playlist", mediaPlaylist},
+		{"master playlist", masterPlaylist},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parsed, err := Parse(tt.data)
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+
+			data, err := parsed.Marshal()
+			if err != nil {
+				t.Fatalf("Marshal() error = %v", err)
+			}
+
+			reparsed, err := Parse(string(data))
+			if err != nil {
+				t.Fatalf("Parse() of the marshaled playlist error = %v", err)
+			}
+
+			if !reflect.DeepEqual(reparsed, parsed) {
+				t.Errorf("Parse(Marshal()) = %+v, want %+v", reparsed, parsed)
+			}
+
+			again, err := reparsed.Marshal()
+			if err != nil {
+				t.Fatalf("Marshal() of the reparsed playlist error = %v", err)
+			}
+
+			if string(again) != string(data) {
+				t.Errorf("Marshal() is not stable, got\n%s\nwant\n%s", again, data)
+			}
+		})
+	}
+}
+
+func TestMarshalKeepsStreamAttributes(t *testing.T) {
+	p, err := Parse(masterPlaylist)
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	data, err := p.Marshal()
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+
+	for _, want := range []string{
+		`SUBTITLES="subs",CLOSED-CAPTIONS="cc",PROGRAM-ID=1` + "\n",
+		`SUBTITLES="subs",CLOSED-CAPTIONS=NONE` + "\n",
+	} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("Marshal() =\n%s\nwant it to contain %q", data, want)
+		}
+	}
+}
+
+func TestParseKeepsTagsInPlace(t *testing.T) {
+	p, err := Parse(mediaPlaylist)
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	wantTags := []Tag{
+		{Name: "#EXT-X-TARGETDURATION", Value: "6"},
+		{Name: "#EXT-X-PLAYLIST-TYPE", Value: "VOD"},
+		{Name: "#EXT-X-INDEPENDENT-SEGMENTS"},
+		{Name: "#EXT-X-MEDIA-READY", Value: "0a1b2c"},
+	}
+	if !reflect.DeepEqual(p.Tags, wantTags) {
+		t.Errorf("Tags = %+v, want %+v", p.Tags, wantTags)
+	}
+
+	wantSegmentTags := [][]Tag{
+		{{Name: "#EXT-X-PROGRAM-DATE-TIME", Value: "2024-05-01T10:00:00.000Z"}},
+		{{Name: "#EXT-X-BYTERANGE", Value: "75232@0"}},
+		{{Name: "#EXT-X-DISCONTINUITY"}},
+		{{Name: "#EXT-X-CUE-OUT", Value: "30"}, {Name: "#EXT-X-CUE-IN"}},
+	}
+	for i, want := range wantSegmentTags {
+		if !reflect.DeepEqual(p.Segments[i].Tags, want) {
+			t.Errorf("Segments[%d].Tags = %+v, want %+v", i, p.Segments[i].Tags, want)
+		}
+	}
+
+	if want := []Tag{{Name: "#EXT-X-ENDLIST"}}; !reflect.DeepEqual(p.EndTags, want) {
+		t.Errorf("EndTags = %+v, want %+v", p.EndTags, want)
+	}
+
+	if value, ok := p.Tag("#EXT-X-MEDIA-READY"); !ok || value != "0a1b2c" {
+		t.Errorf("Tag() = %q, %v, want 0a1b2c", value, ok)
+	}
+
+	if value, ok := p.Segments[1].Tag("#EXT-X-BYTERANGE"); !ok || value != "75232@0" {
+		t.Errorf("Segments[1].Tag() = %q, %v, want 75232@0", value, ok)
+	}
+	if _, ok := p.Segments[0].Tag("#EXT-X-BYTERANGE"); ok {
+		t.Errorf("Segments[0].Tag() found #EXT-X-BYTERANGE, want none")
+	}
+}
+
+func TestMarshalBuiltPlaylist(t *testing.T) {
+	key := &Key{Method: KeyMethodAES128, URI: "key.bin", KeyFormat: KeyFormatIdentity}
+	p := &Playlist{
+		Segments: []Segment{
+			{Url: "seg0.ts", Duration: 4500 * time.Millisecond, Key: key},
+			{Url: "seg1.ts", Duration: 6 * time.Second, Key: key},
+		},
+		EndTags: []Tag{{Name: "#EXT-X-ENDLIST"}},
+	}
+
+	data, err := p.Marshal()
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+
+	want := `#EXTM3U
+#EXT-X-TARGETDURATION:6
+#EXT-X-KEY:METHOD=AES-128,URI="key.bin"
+#EXTINF:4.5,
+seg0.ts
+#EXTINF:6,
+seg1.ts
+#EXT-X-ENDLIST
+`
+	if string(data) != want {
+		t.Errorf("Marshal() =\n%s\nwant\n%s", data, want)
+	}
+
+	if _, err := (&Playlist{Segments: []Segment{{Duration: time.Second}}}).Marshal(); err == nil || !strings.Contains(err.Error(), "no URL") {
+		t.Errorf("Marshal() of a segment without URL error = %v, want an error", err)
+	}
+}
@@ -0,0 +1,67 @@
+package m3u8
+
+import "fmt"
+
+const (
+	MediaTypeAudio          = "AUDIO"
+	MediaTypeVideo          = "VIDEO"
+	MediaTypeSubtitles      = "SUBTITLES"
+	MediaTypeClosedCaptions = "CLOSED-CAPTIONS"
+)
+
+// Media is an #EXT-X-MEDIA tag, an alternative rendition of a master playlist
+// Streams refer to the renditions of a type by their GroupID
+type Media struct {
+	Type    string
+	GroupID string
+	Name    string
+	// URI is the media playlist of the rendition, it is empty if the rendition is part of the stream
+	URI             string
+	Language        string
+	AssocLanguage   string
+	Default         bool
+	Autoselect      bool
+	Forced          bool
+	InstreamID      string
+	Characteristics string
+	Channels        string
+}
+
+func parseMedia(attrsStr string) (Media, error) {
+	var m Media
+
+	attrs, err := ParseAttributeList(attrsStr)
+	if err != nil {
+		return m, err
+	}
+
+	m = Media{
+		Type:            attrs.Enum("TYPE"),
+		GroupID:         attrs.String("GROUP-ID"),
+		Name:            attrs.String("NAME"),
+		URI:             attrs.String("URI"),
+		Language:        attrs.String("LANGUAGE"),
+		AssocLanguage:   attrs.String("ASSOC-LANGUAGE"),
+		Default:         attrs.Enum("DEFAULT") == "YES",
+		Autoselect:      attrs.Enum("AUTOSELECT") == "YES",
+		Forced:          attrs.Enum("FORCED") == "YES",
+		InstreamID:      attrs.String("INSTREAM-ID"),
+		Characteristics: attrs.String("CHARACTERISTICS"),
+		Channels:        attrs.String("CHANNELS"),
+	}
+
+	if m.Type == "" {
+		return m, fmt.Errorf("media has no TYPE")
+	}
+	if m.GroupID == "" {
+		return m, fmt.Errorf("media has no GROUP-ID")
+	}
+	if m.Name == "" {
+		return m, fmt.Errorf("media has no NAME")
+	}
+	if m.Type == MediaTypeClosedCaptions && m.URI != "" {
+		return m, fmt.Errorf("closed captions media has a URI")
+	}
+
+	return m, nil
+}
@@ -1,30 +1,104 @@
 package m3u8
 
+import "fmt"
+
 type Playlist struct {
-	Version  int
-	IsMaster bool
-	Streams  []Stream
+	Version       int
+	IsMaster      bool
+	MediaSequence int
+	Streams       []Stream
+	// IFrameStreams are the I-frame only streams of a master playlist, e.g. for trick play
+	IFrameStreams []Stream
+	// Media are the alternative renditions of a master playlist
+	Media    []Media
 	Segments []Segment
-	Rest     map[string]string
+	// Tags are the tags without a typed field before the first segment, in playlist order
+	Tags []Tag
+	// EndTags are the tags without a typed field after the last segment, e.g. #EXT-X-ENDLIST
+	EndTags []Tag
 }
 
-func (p *Playlist) GetStreamByResolution(width, height int) *Stream {
-	for _, s := range p.Streams {
-		if s.Resolution.Width == width && s.Resolution.Height == height {
-			return &s
+// Tag returns the value of the first tag of Tags with the name
+func (p *Playlist) Tag(name string) (string, bool) {
+	for _, tag := range p.Tags {
+		if tag.Name == name {
+			return tag.Value, true
 		}
 	}
 
-	return nil
+	return "", false
+}
+
+// Quality describes which stream of a master playlist to select, zero fields match any stream
+type Quality struct {
+	// Resolution selects the stream with exactly this resolution
+	Resolution Resolution
+	// MaxHeight excludes streams taller than this
+	MaxHeight int
+	// MaxBandwidth excludes streams with a higher peak bandwidth in bits per second
+	MaxBandwidth int
+	// Lowest prefers the lowest quality among the matching streams instead of the highest
+	Lowest bool
 }
 
-func (p *Playlist) GetBestResolutionStream() *Stream {
-	var best Stream
+// Matches reports whether the stream satisfies the constraints of the quality
+// A stream without a resolution has no height, so MaxHeight does not exclude it, SelectStream skips such streams
+// unless no stream has a resolution
+func (q Quality) Matches(s Stream) bool {
+	if q.Resolution != (Resolution{}) && s.Resolution != q.Resolution {
+		return false
+	}
+	if q.MaxHeight > 0 && s.Resolution.Height > q.MaxHeight {
+		return false
+	}
+	if q.MaxBandwidth > 0 && s.Bandwidth > q.MaxBandwidth {
+		return false
+	}
+
+	return true
+}
+
+// SelectStream returns the highest, or with Quality.Lowest the lowest, quality stream matching q
+// Streams are ordered by pixel count, then by bandwidth
+// Streams without a resolution, e.g. audio-only ones, are only selected if no stream has a resolution
+func (p *Playlist) SelectStream(q Quality) (*Stream, error) {
+	hasResolution := false
 	for _, s := range p.Streams {
-		if s.Resolution.Width > best.Resolution.Width && s.Resolution.Height > best.Resolution.Height {
-			best = s
+		if s.Resolution != (Resolution{}) {
+			hasResolution = true
+			break
 		}
 	}
 
-	return &best
+	var selected *Stream
+	for i := range p.Streams {
+		s := &p.Streams[i]
+		if hasResolution && s.Resolution == (Resolution{}) {
+			continue
+		}
+		if !q.Matches(*s) {
+			continue
+		}
+		if selected == nil || betterStream(*s, *selected) != q.Lowest {
+			selected = s
+		}
+	}
+
+	if selected == nil {
+		return nil, fmt.Errorf("no stream matches the requested quality, %d streams available", len(p.Streams))
+	}
+
+	result := *selected
+	return &result, nil
+}
+
+// betterStream reports whether a has a higher quality than b
+func betterStream(a, b Stream) bool {
+	aPixels := a.Resolution.Width * a.Resolution.Height
+	bPixels := b.Resolution.Width * b.Resolution.Height
+	if aPixels != bPixels {
+		return aPixels > bPixels
+	}
+
+	return a.Bandwidth > b.Bandwidth
 }
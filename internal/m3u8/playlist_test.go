@@ -0,0 +1,57 @@
+package m3u8
+
+import "testing"
+
+func TestSelectStream(t *testing.T) {
+	master := &Playlist{
+		IsMaster: true,
+		Streams: []Stream{
+			{Url: "audio.m3u8", Bandwidth: 64000},
+			{Url: "360p.m3u8", Bandwidth: 800000, Resolution: Resolution{Width: 640, Height: 360}},
+			{Url: "720p.m3u8", Bandwidth: 2500000, Resolution: Resolution{Width: 1280, Height: 720}},
+			{Url: "720p-hi.m3u8", Bandwidth: 4000000, Resolution: Resolution{Width: 1280, Height: 720}},
+			{Url: "1080p.m3u8", Bandwidth: 6000000, Resolution: Resolution{Width: 1920, Height: 1080}},
+		},
+	}
+	audioOnly := &Playlist{
+		IsMaster: true,
+		Streams: []Stream{
+			{Url: "low.m3u8", Bandwidth: 64000},
+			{Url: "high.m3u8", Bandwidth: 128000},
+		},
+	}
+
+	tests := []struct {
+		name     string
+		playlist *Playlist
+		quality  Quality
+		want     string
+	}{
+		{"highest", master, Quality{}, "1080p.m3u8"},
+		{"lowest skips the audio-only stream", master, Quality{Lowest: true}, "360p.m3u8"},
+		{"max height skips the audio-only stream", master, Quality{MaxHeight: 300}, ""},
+		{"max height", master, Quality{MaxHeight: 720}, "720p-hi.m3u8"},
+		{"resolution prefers the lower bandwidth", master, Quality{Resolution: Resolution{Width: 1280, Height: 720}, Lowest: true}, "720p.m3u8"},
+		{"max bandwidth", master, Quality{MaxBandwidth: 3000000}, "720p.m3u8"},
+		{"no stream has a resolution", audioOnly, Quality{}, "high.m3u8"},
+		{"no stream has a resolution, lowest", audioOnly, Quality{Lowest: true, MaxHeight: 720}, "low.m3u8"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := tt.playlist.SelectStream(tt.quality)
+			if tt.want == "" {
+				if err == nil {
+					t.Fatalf("SelectStream() = %+v, want an error", s)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("SelectStream() error = %v", err)
+			}
+			if s.Url != tt.want {
+				t.Errorf("SelectStream() = %s, want %s", s.Url, tt.want)
+			}
+		})
+	}
+}
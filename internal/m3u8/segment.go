@@ -1,8 +1,45 @@
 package m3u8
 
-import "time"
+import (
+	"encoding/binary"
+	"time"
+)
 
 type Segment struct {
 	Url      string
 	Duration time.Duration
+	// Title is the optional title of the #EXTINF tag
+	Title string
+	// Sequence is the media sequence number of the segment
+	Sequence int
+	// Key is the key the segment is encrypted with, nil for clear segments
+	Key *Key
+	// Map is the media initialization section of the segment, nil if there is none
+	Map *Map
+	// Tags are the tags without a typed field between the previous segment and this one, e.g. #EXT-X-DISCONTINUITY
+	Tags []Tag
+}
+
+// Tag returns the value of the first tag of Tags with the name
+func (s *Segment) Tag(name string) (string, bool) {
+	for _, tag := range s.Tags {
+		if tag.Name == name {
+			return tag.Value, true
+		}
+	}
+
+	return "", false
+}
+
+// IV returns the initialization vector of the segment
+// Without an explicit IV attribute the media sequence number is used as a big-endian 128-bit integer
+func (s *Segment) IV() []byte {
+	if s.Key != nil && s.Key.IV != nil {
+		return s.Key.IV
+	}
+
+	iv := make([]byte, 16)
+	binary.BigEndian.PutUint64(iv[8:], uint64(s.Sequence))
+
+	return iv
 }
@@ -6,7 +6,34 @@ type Resolution struct {
 }
 
 type Stream struct {
-	Url        string
-	Bandwidth  int
-	Resolution Resolution
+	Url              string
+	Bandwidth        int
+	AverageBandwidth int
+	Resolution       Resolution
+	Codecs           []string
+	FrameRate        float64
+	HDCPLevel        string
+	// Audio, Video, Subtitles and ClosedCaptions are the group ids of the renditions of the stream
+	// ClosedCaptions is NONE if the stream has no closed captions
+	Audio          string
+	Video          string
+	Subtitles      string
+	ClosedCaptions string
+	// Attributes are the attributes without a typed field, e.g. PROGRAM-ID, they are kept to write the playlist back as it was
+	Attributes AttributeList
+}
+
+// streamAttributes are the attributes with a typed field of #EXT-X-STREAM-INF and #EXT-X-I-FRAME-STREAM-INF
+var streamAttributes = map[string]bool{
+	"BANDWIDTH":         true,
+	"AVERAGE-BANDWIDTH": true,
+	"RESOLUTION":        true,
+	"FRAME-RATE":        true,
+	"CODECS":            true,
+	"HDCP-LEVEL":        true,
+	"AUDIO":             true,
+	"VIDEO":             true,
+	"SUBTITLES":         true,
+	"CLOSED-CAPTIONS":   true,
+	"URI":               true,
 }
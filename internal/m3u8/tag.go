@@ -0,0 +1,28 @@
+package m3u8
+
+// Tag is a tag without a typed field, it is kept to write the playlist back as it was
+type Tag struct {
+	// Name includes the leading #, e.g. "#EXT-X-DISCONTINUITY"
+	Name string
+	// Value is the part after the colon, it is empty if the tag has none
+	Value string
+}
+
+// mediaSegmentTags are the tags without a typed field that apply to the next segment
+// Before the first segment they tell the tags of the first segment from the tags of the playlist
+var mediaSegmentTags = map[string]bool{
+	"#EXT-X-BYTERANGE":         true,
+	"#EXT-X-DISCONTINUITY":     true,
+	"#EXT-X-PROGRAM-DATE-TIME": true,
+	"#EXT-X-DATERANGE":         true,
+	"#EXT-X-GAP":               true,
+	"#EXT-X-BITRATE":           true,
+}
+
+func (t Tag) String() string {
+	if t.Value == "" {
+		return t.Name
+	}
+
+	return t.Name + ":" + t.Value
+}
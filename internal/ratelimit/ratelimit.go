@@ -0,0 +1,219 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// minBurst keeps the bucket large enough for a typical read at low rates
+const minBurst = 16 * 1024
+
+// Limiter is a token bucket limiting the bytes per second read by all readers sharing it
+// A nil limiter does not limit anything
+type Limiter struct {
+	// rate is the limit in bytes per second outside of the windows, 0 means unlimited
+	rate    int64
+	windows []window
+
+	mutex  sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+// window limits the rate during a time of day, a window that ends before it starts spans midnight
+// The first window containing the current time overrides the rate of the limiter
+type window struct {
+	// start and end are offsets from midnight in local time
+	start time.Duration
+	end   time.Duration
+	// rate is the limit in bytes per second, 0 means unlimited
+	rate int64
+}
+
+func (w window) contains(t time.Time) bool {
+	year, month, day := t.Date()
+	offset := t.Sub(time.Date(year, month, day, 0, 0, 0, 0, t.Location()))
+
+	if w.start <= w.end {
+		return offset >= w.start && offset < w.end
+	}
+	return offset >= w.start || offset < w.end
+}
+
+// Parse parses a comma separated list of rates, e.g. "2M" or "09:00-18:00=500K,2M"
+// A rate is a number of bytes per second with an optional K, M or G suffix, a rate with a time window
+// only applies during that time of day, the rate without a window applies at all other times
+func Parse(s string) (*Limiter, error) {
+	l := &Limiter{}
+
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+
+		span, rate, ok := strings.Cut(part, "=")
+		if !ok {
+			r, err := parseRate(part)
+			if err != nil {
+				return nil, err
+			}
+			l.rate = r
+			continue
+		}
+
+		start, end, ok := strings.Cut(span, "-")
+		if !ok {
+			return nil, fmt.Errorf("invalid time window %q, expected HH:MM-HH:MM", span)
+		}
+
+		var w window
+		var err error
+		if w.start, err = parseTimeOfDay(start); err != nil {
+			return nil, err
+		}
+		if w.end, err = parseTimeOfDay(end); err != nil {
+			return nil, err
+		}
+		if w.rate, err = parseRate(rate); err != nil {
+			return nil, err
+		}
+
+		l.windows = append(l.windows, w)
+	}
+
+	return l, nil
+}
+
+// parseRate parses a number of bytes with an optional K, M or G suffix, the suffixes are powers of 1024
+func parseRate(rate string) (int64, error) {
+	s := strings.TrimSpace(rate)
+
+	multiplier := 1.0
+	if s != "" {
+		switch strings.ToUpper(s[len(s)-1:]) {
+		case "K":
+			multiplier = 1 << 10
+		case "M":
+			multiplier = 1 << 20
+		case "G":
+			multiplier = 1 << 30
+		}
+		if multiplier != 1 {
+			s = s[:len(s)-1]
+		}
+	}
+
+	value, err := strconv.ParseFloat(s, 64)
+	if err != nil || value < 0 {
+		return 0, fmt.Errorf("invalid rate %q, expected e.g. 500K or 2M", rate)
+	}
+
+	return int64(value * multiplier), nil
+}
+
+func parseTimeOfDay(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(s))
+	if err != nil {
+		return 0, fmt.Errorf("invalid time of day %q, expected HH:MM", s)
+	}
+
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// rateAt returns the rate in bytes per second at the time
+func (l *Limiter) rateAt(t time.Time) int64 {
+	for _, w := range l.windows {
+		if w.contains(t) {
+			return w.rate
+		}
+	}
+
+	return l.rate
+}
+
+// burst returns the size of the bucket for the rate, a quarter of a second of data
+func burst(rate int64) int {
+	return max(int(rate/4), minBurst)
+}
+
+// wait blocks until n bytes may pass
+// Tokens are reserved before waiting, so readers sharing the limiter are served in turn
+func (l *Limiter) wait(ctx context.Context, n int) error {
+	for n > 0 {
+		l.mutex.Lock()
+
+		now := time.Now()
+		rate := l.rateAt(now)
+		if rate <= 0 {
+			l.tokens = 0
+			l.last = now
+			l.mutex.Unlock()
+			return nil
+		}
+
+		size := burst(rate)
+		if !l.last.IsZero() {
+			l.tokens += now.Sub(l.last).Seconds() * float64(rate)
+		}
+		l.tokens = min(l.tokens, float64(size))
+		l.last = now
+
+		take := min(n, size)
+		l.tokens -= float64(take)
+		n -= take
+
+		var delay time.Duration
+		if l.tokens < 0 {
+			delay = time.Duration(-l.tokens / float64(rate) * float64(time.Second))
+		}
+
+		l.mutex.Unlock()
+
+		if delay > 0 {
+			timer := time.NewTimer(delay)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return ctx.Err()
+			case <-timer.C:
+			}
+		}
+	}
+
+	return nil
+}
+
+// Reader returns a reader that limits reading r, it returns r if the limiter is nil
+func (l *Limiter) Reader(ctx context.Context, r io.Reader) io.Reader {
+	if l == nil {
+		return r
+	}
+
+	return &reader{ctx: ctx, r: r, limiter: l}
+}
+
+type reader struct {
+	ctx     context.Context
+	r       io.Reader
+	limiter *Limiter
+}
+
+func (r *reader) Read(p []byte) (int, error) {
+	// small reads keep the rate smooth instead of waiting for a whole buffer at once
+	l := r.limiter
+	if size := burst(l.rateAt(time.Now())); len(p) > size {
+		p = p[:size]
+	}
+
+	n, err := r.r.Read(p)
+	if n > 0 {
+		if waitErr := l.wait(r.ctx, n); waitErr != nil {
+			return n, waitErr
+		}
+	}
+
+	return n, err
+}
@@ -0,0 +1,125 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name string
+		s    string
+		want *Limiter
+	}{
+		{"megabytes", "2M", &Limiter{rate: 2 << 20}},
+		{"fractional kilobytes", "1.5k", &Limiter{rate: 1536}},
+		{"plain bytes", "1000", &Limiter{rate: 1000}},
+		{"window and default", "09:00-18:00=500K,2M", &Limiter{
+			rate:    2 << 20,
+			windows: []window{{start: 9 * time.Hour, end: 18 * time.Hour, rate: 500 << 10}},
+		}},
+		{"window across midnight", "22:00-06:00=0", &Limiter{
+			windows: []window{{start: 22 * time.Hour, end: 6 * time.Hour}},
+		}},
+		{"spaces", " 08:30 - 12:00 = 1G , 100K ", &Limiter{
+			rate:    100 << 10,
+			windows: []window{{start: 8*time.Hour + 30*time.Minute, end: 12 * time.Hour, rate: 1 << 30}},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(tt.s)
+			if err != nil {
+				t.Fatalf("Parse(%q) error = %v", tt.s, err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Parse(%q) = %+v, want %+v", tt.s, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []string{
+		"2MB",
+		"-1",
+		"",
+		"2M,",
+		"abc",
+		"09:00=1M",
+		"9-18=1M",
+		"25:00-06:00=1M",
+		"09:00-18:00=fast",
+	}
+
+	for _, s := range tests {
+		t.Run(s, func(t *testing.T) {
+			if l, err := Parse(s); err == nil {
+				t.Errorf("Parse(%q) = %+v, want an error", s, l)
+			}
+		})
+	}
+}
+
+func TestWindowContains(t *testing.T) {
+	day := window{start: 9 * time.Hour, end: 18 * time.Hour}
+	night := window{start: 22 * time.Hour, end: 6 * time.Hour}
+
+	at := func(hour, minute int) time.Time {
+		return time.Date(2024, 5, 1, hour, minute, 0, 0, time.Local)
+	}
+
+	tests := []struct {
+		name   string
+		window window
+		t      time.Time
+		want   bool
+	}{
+		{"before the start", day, at(8, 59), false},
+		{"at the start", day, at(9, 0), true},
+		{"inside", day, at(12, 0), true},
+		{"just before the end", day, at(17, 59), true},
+		{"at the end", day, at(18, 0), false},
+		{"across midnight, before the start", night, at(21, 59), false},
+		{"across midnight, at the start", night, at(22, 0), true},
+		{"across midnight, at midnight", night, at(0, 0), true},
+		{"across midnight, just before the end", night, at(5, 59), true},
+		{"across midnight, at the end", night, at(6, 0), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.window.contains(tt.t); got != tt.want {
+				t.Errorf("contains(%s) = %v, want %v", tt.t.Format("15:04"), got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWait(t *testing.T) {
+	unlimited := &Limiter{}
+	if err := unlimited.wait(context.Background(), 1<<30); err != nil {
+		t.Errorf("wait() of an unlimited limiter error = %v", err)
+	}
+
+	// a full bucket lets the first burst pass at once
+	limited := &Limiter{rate: 1 << 20, tokens: float64(burst(1 << 20))}
+	start := time.Now()
+	if err := limited.wait(context.Background(), burst(1<<20)); err != nil {
+		t.Fatalf("wait() error = %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Errorf("wait() of a burst took %v, want no delay", elapsed)
+	}
+
+	// reading far more than the rate allows waits until the context is cancelled
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := limited.wait(ctx, 10<<20); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("wait() error = %v, want context.DeadlineExceeded", err)
+	}
+}
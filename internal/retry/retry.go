@@ -0,0 +1,144 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"slices"
+	"time"
+)
+
+// Policy describes how failed requests are retried
+type Policy struct {
+	// MaxAttempts is the total number of attempts, values below 1 mean a single attempt
+	MaxAttempts int
+	// BaseDelay is the delay before the first retry, it doubles with every attempt
+	BaseDelay time.Duration
+	// MaxDelay caps the backoff delay and the delay requested by Retry-After
+	MaxDelay time.Duration
+	// RetryableStatuses are the HTTP status codes that are retried
+	RetryableStatuses []int
+}
+
+// DefaultPolicy is used when no policy is configured
+var DefaultPolicy = Policy{
+	MaxAttempts: 5,
+	BaseDelay:   500 * time.Millisecond,
+	MaxDelay:    30 * time.Second,
+	RetryableStatuses: []int{
+		http.StatusRequestTimeout,
+		http.StatusTooEarly,
+		http.StatusTooManyRequests,
+		http.StatusInternalServerError,
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout,
+	},
+}
+
+// Delayer is implemented by errors that request a minimum delay before the next attempt,
+// e.g. responses with a Retry-After header
+type Delayer interface {
+	RetryDelay() time.Duration
+}
+
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e *permanentError) Unwrap() error {
+	return e.err
+}
+
+// Permanent marks the error as not retryable
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+// Do calls fn until it succeeds, returns a permanent error or the attempts are exhausted
+// desc describes the operation in log messages
+func (p Policy) Do(ctx context.Context, desc string, fn func() error) error {
+	attempts := max(p.MaxAttempts, 1)
+
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil {
+			return nil
+		}
+
+		var permanent *permanentError
+		if errors.As(err, &permanent) {
+			return err
+		}
+
+		if ctx.Err() != nil {
+			return interrupted(ctx, err)
+		}
+
+		if attempt >= attempts {
+			if attempts > 1 {
+				return fmt.Errorf("giving up after %d attempts: %w", attempts, err)
+			}
+			return err
+		}
+
+		delay := p.delay(attempt, err)
+		slog.Warn("Request failed, retrying", "request", desc, "attempt", attempt, "of", attempts, "delay", delay, "err", err)
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return interrupted(ctx, err)
+		case <-timer.C:
+		}
+	}
+}
+
+// interrupted returns the error of the cancelled context with the error of the last attempt in its message
+// so that callers tell an interruption from a failure
+func interrupted(ctx context.Context, err error) error {
+	if errors.Is(err, ctx.Err()) {
+		return err
+	}
+	return fmt.Errorf("%w (last attempt: %v)", ctx.Err(), err)
+}
+
+// Retryable reports whether responses with the HTTP status code are retried
+func (p Policy) Retryable(statusCode int) bool {
+	return slices.Contains(p.RetryableStatuses, statusCode)
+}
+
+// delay returns the exponential backoff with jitter for the attempt
+// A longer delay requested by the error takes precedence
+func (p Policy) delay(attempt int, err error) time.Duration {
+	backoff := p.BaseDelay << min(attempt-1, 30)
+	if backoff <= 0 || (p.MaxDelay > 0 && backoff > p.MaxDelay) {
+		backoff = p.MaxDelay
+	}
+
+	// equal jitter, keeps at least half of the backoff
+	if half := backoff / 2; half > 0 {
+		backoff = half + rand.N(half)
+	}
+
+	var delayer Delayer
+	if errors.As(err, &delayer) && delayer.RetryDelay() > backoff {
+		backoff = delayer.RetryDelay()
+		if p.MaxDelay > 0 && backoff > p.MaxDelay {
+			backoff = p.MaxDelay
+		}
+	}
+
+	return backoff
+}
@@ -0,0 +1,121 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// delayError is a retryable error requesting a delay like a Retry-After header
+type delayError struct {
+	delay time.Duration
+}
+
+func (e *delayError) Error() string {
+	return "retry later"
+}
+
+func (e *delayError) RetryDelay() time.Duration {
+	return e.delay
+}
+
+func TestDo(t *testing.T) {
+	errFailed := errors.New("failed")
+
+	tests := []struct {
+		name string
+		// errs are returned by the attempts in order, the attempts after the last one succeed
+		errs []error
+		// cancel cancels the context after the first attempt
+		cancel       bool
+		wantAttempts int
+		wantErr      error
+		wantMessage  string
+	}{
+		{"success", nil, false, 1, nil, ""},
+		{"success after retries", []error{errFailed, errFailed}, false, 3, nil, ""},
+		{"permanent error", []error{Permanent(errFailed)}, false, 1, errFailed, ""},
+		{"attempts exhausted", []error{errFailed, errFailed, errFailed, errFailed}, false, 3, errFailed, "giving up after 3 attempts"},
+		{"cancelled during the wait", []error{errFailed, errFailed}, true, 1, context.Canceled, "last attempt: failed"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			p := Policy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond}
+			if tt.cancel {
+				// the wait outlasts the test unless the cancellation ends it
+				p.BaseDelay, p.MaxDelay = time.Hour, time.Hour
+			}
+
+			attempts := 0
+			err := p.Do(ctx, "test", func() error {
+				attempts++
+				if tt.cancel {
+					time.AfterFunc(10*time.Millisecond, cancel)
+				}
+				if attempts <= len(tt.errs) {
+					return tt.errs[attempts-1]
+				}
+				return nil
+			})
+
+			if attempts != tt.wantAttempts {
+				t.Errorf("Do() made %d attempts, want %d", attempts, tt.wantAttempts)
+			}
+			if tt.wantErr == nil {
+				if err != nil {
+					t.Fatalf("Do() error = %v, want nil", err)
+				}
+				return
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Do() error = %v, want an error wrapping %v", err, tt.wantErr)
+			}
+			if !strings.Contains(err.Error(), tt.wantMessage) {
+				t.Errorf("Do() error = %v, want an error containing %q", err, tt.wantMessage)
+			}
+		})
+	}
+}
+
+func TestDoCancelledAttempt(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := DefaultPolicy.Do(ctx, "test", func() error {
+		return ctx.Err()
+	})
+	if !errors.Is(err, context.Canceled) || strings.Contains(err.Error(), "last attempt") {
+		t.Errorf("Do() error = %v, want the context error as is", err)
+	}
+}
+
+func TestDelayHonoursRetryAfter(t *testing.T) {
+	p := Policy{BaseDelay: 100 * time.Millisecond, MaxDelay: 10 * time.Second}
+
+	tests := []struct {
+		name string
+		err  error
+		min  time.Duration
+		max  time.Duration
+	}{
+		{"backoff with jitter", errors.New("failed"), 100 * time.Millisecond, 200 * time.Millisecond},
+		{"shorter Retry-After keeps the backoff", &delayError{delay: time.Millisecond}, 100 * time.Millisecond, 200 * time.Millisecond},
+		{"longer Retry-After", &delayError{delay: 5 * time.Second}, 5 * time.Second, 5 * time.Second},
+		{"Retry-After capped by MaxDelay", &delayError{delay: time.Hour}, 10 * time.Second, 10 * time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// the second attempt doubles the base delay to 200ms, the jitter keeps at least half of it
+			if delay := p.delay(2, tt.err); delay < tt.min || delay > tt.max {
+				t.Errorf("delay() = %v, want between %v and %v", delay, tt.min, tt.max)
+			}
+		})
+	}
+}
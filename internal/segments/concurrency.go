@@ -0,0 +1,160 @@
+package segments
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"omnivorous/internal/httpclient"
+	"sync"
+	"time"
+)
+
+// DefaultConcurrency is the number of simultaneous segment downloads when none is configured
+const DefaultConcurrency = 10
+
+// initialAdaptiveConcurrency is where an adaptive pool starts before it has measured anything
+const initialAdaptiveConcurrency = 4
+
+// minAdjustInterval is the shortest window over which throughput is measured
+const minAdjustInterval = 2 * time.Second
+
+// pool limits the number of simultaneous segment downloads
+// An adaptive pool grows while the throughput improves and shrinks on errors, falling throughput and throttling responses
+type pool struct {
+	mutex    sync.Mutex
+	changed  chan struct{}
+	active   int
+	limit    int
+	max      int
+	adaptive bool
+
+	// the measurements of the current window
+	windowStart time.Time
+	completed   int
+	failed      int
+	throttled   bool
+	bytes       int64
+	// throughput is the throughput of the previous window in bytes per second
+	throughput float64
+}
+
+func newPool(concurrency int, adaptive bool) *pool {
+	if concurrency <= 0 {
+		concurrency = DefaultConcurrency
+	}
+
+	p := &pool{
+		changed:     make(chan struct{}),
+		limit:       concurrency,
+		max:         concurrency,
+		adaptive:    adaptive,
+		windowStart: time.Now(),
+	}
+	if adaptive {
+		p.limit = min(initialAdaptiveConcurrency, concurrency)
+	}
+
+	return p
+}
+
+// acquire waits for a free slot
+func (p *pool) acquire(ctx context.Context) error {
+	for {
+		p.mutex.Lock()
+		if p.active < p.limit {
+			p.active++
+			p.mutex.Unlock()
+			return nil
+		}
+		changed := p.changed
+		p.mutex.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-changed:
+		}
+	}
+}
+
+// release frees a slot taken by acquire
+func (p *pool) release() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.active--
+	p.notify()
+}
+
+// notify wakes up the waiting acquire calls, the mutex must be held
+func (p *pool) notify() {
+	close(p.changed)
+	p.changed = make(chan struct{})
+}
+
+// report records the outcome of a download attempt, adaptive pools adjust their limit based on it
+func (p *pool) report(bytes int64, err error) {
+	if !p.adaptive {
+		return
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if err != nil {
+		p.failed++
+	} else {
+		p.completed++
+		p.bytes += bytes
+	}
+
+	var statusErr *httpclient.StatusError
+	if errors.As(err, &statusErr) && (statusErr.StatusCode == http.StatusTooManyRequests || statusErr.StatusCode == http.StatusServiceUnavailable) {
+		// back off at once, but only once per window, as the other in-flight requests are likely throttled as well
+		if !p.throttled {
+			p.throttled = true
+			p.setLimit(p.limit/2, "throttled by the server")
+		}
+		return
+	}
+
+	elapsed := time.Since(p.windowStart)
+	if elapsed < minAdjustInterval || p.completed+p.failed < p.limit {
+		return
+	}
+
+	throughput := float64(p.bytes) / elapsed.Seconds()
+	errorRate := float64(p.failed) / float64(p.completed+p.failed)
+
+	switch {
+	case p.throttled:
+		// the decrease already happened when the throttling was reported
+	case errorRate > 0.2:
+		p.setLimit(p.limit-1, "high error rate")
+	case throughput >= p.throughput*1.05:
+		p.setLimit(p.limit+1, "throughput improved")
+	case throughput < p.throughput*0.9:
+		p.setLimit(p.limit-1, "throughput dropped")
+	}
+
+	p.throughput = throughput
+	p.windowStart = time.Now()
+	p.completed = 0
+	p.failed = 0
+	p.bytes = 0
+	p.throttled = false
+}
+
+// setLimit changes the limit within 1 and the maximum, the mutex must be held
+func (p *pool) setLimit(limit int, reason string) {
+	limit = max(1, min(limit, p.max))
+	if limit == p.limit {
+		return
+	}
+
+	slog.Debug("Adjusting concurrency", "from", p.limit, "to", limit, "reason", reason)
+
+	p.limit = limit
+	p.notify()
+}
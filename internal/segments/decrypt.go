@@ -0,0 +1,73 @@
+package segments
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"fmt"
+	"io"
+)
+
+// decryptWriter decrypts AES-128-CBC data written to it and writes the plain text to w
+// The last block is held back until Close, which removes the PKCS#7 padding, so memory use does not depend on the data size
+type decryptWriter struct {
+	w       io.Writer
+	decrypt cipher.BlockMode
+	// buf holds the cipher text that is not decrypted yet, at most one write plus one block
+	buf []byte
+}
+
+func newDecryptWriter(w io.Writer, key, iv []byte) (*decryptWriter, error) {
+	aesCipher, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("error creating cipher: %w", err)
+	}
+
+	if len(iv) != aes.BlockSize {
+		return nil, fmt.Errorf("invalid IV length %d", len(iv))
+	}
+
+	return &decryptWriter{
+		w:       w,
+		decrypt: cipher.NewCBCDecrypter(aesCipher, iv),
+	}, nil
+}
+
+func (d *decryptWriter) Write(p []byte) (int, error) {
+	d.buf = append(d.buf, p...)
+
+	// decrypt all complete blocks but the last one, it may contain the padding
+	n := len(d.buf) - len(d.buf)%aes.BlockSize
+	if n == len(d.buf) {
+		n -= aes.BlockSize
+	}
+	if n <= 0 {
+		return len(p), nil
+	}
+
+	d.decrypt.CryptBlocks(d.buf[:n], d.buf[:n])
+	if _, err := d.w.Write(d.buf[:n]); err != nil {
+		return 0, err
+	}
+
+	d.buf = append(d.buf[:0], d.buf[n:]...)
+
+	return len(p), nil
+}
+
+// Close decrypts the last block and writes it without the padding
+// It does not close the underlying writer
+func (d *decryptWriter) Close() error {
+	if len(d.buf) != aes.BlockSize {
+		return fmt.Errorf("encrypted data is not a multiple of the block size")
+	}
+
+	d.decrypt.CryptBlocks(d.buf, d.buf)
+
+	padding := int(d.buf[len(d.buf)-1])
+	if padding == 0 || padding > aes.BlockSize {
+		return fmt.Errorf("invalid padding")
+	}
+
+	_, err := d.w.Write(d.buf[:len(d.buf)-padding])
+	return err
+}
@@ -0,0 +1,139 @@
+package segments
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"testing"
+)
+
+var (
+	testKey = []byte("0123456789abcdef")
+	testIV  = []byte("fedcba9876543210")
+)
+
+// encrypt encrypts the plain text with AES-128-CBC and PKCS#7 padding like an HLS segment
+func encrypt(t *testing.T, plain []byte) []byte {
+	t.Helper()
+
+	block, err := aes.NewCipher(testKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	padding := aes.BlockSize - len(plain)%aes.BlockSize
+	data := append(bytes.Clone(plain), bytes.Repeat([]byte{byte(padding)}, padding)...)
+	cipher.NewCBCEncrypter(block, testIV).CryptBlocks(data, data)
+
+	return data
+}
+
+func TestDecryptWriter(t *testing.T) {
+	sizes := []int{0, 1, 15, 16, 17, 31, 32, 1000, 4096}
+	chunkSizes := []int{1, 7, 15, 16, 17, 32, 33, 1 << 20}
+
+	for _, size := range sizes {
+		plain := make([]byte, size)
+		for i := range plain {
+			plain[i] = byte(i * 7)
+		}
+		encrypted := encrypt(t, plain)
+
+		for _, chunkSize := range chunkSizes {
+			var out bytes.Buffer
+			d, err := newDecryptWriter(&out, testKey, testIV)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for data := encrypted; len(data) > 0; {
+				n := min(chunkSize, len(data))
+				written, err := d.Write(data[:n])
+				if err != nil || written != n {
+					t.Fatalf("size %d, chunks of %d: Write() = %d, %v, want %d", size, chunkSize, written, err, n)
+				}
+				data = data[n:]
+			}
+
+			if err := d.Close(); err != nil {
+				t.Fatalf("size %d, chunks of %d: Close() error = %v", size, chunkSize, err)
+			}
+
+			if !bytes.Equal(out.Bytes(), plain) {
+				t.Fatalf("size %d, chunks of %d: decrypted %d bytes that differ from the plain text", size, chunkSize, out.Len())
+			}
+		}
+	}
+}
+
+func TestDecryptWriterHoldsBackLastBlock(t *testing.T) {
+	encrypted := encrypt(t, make([]byte, 48))
+
+	var out bytes.Buffer
+	d, err := newDecryptWriter(&out, testKey, testIV)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := d.Write(encrypted[:48]); err != nil {
+		t.Fatal(err)
+	}
+	// the last written block may be the padding block, it is only decrypted once more data or Close follows
+	if out.Len() != 32 {
+		t.Fatalf("wrote %d bytes before Close, want 32", out.Len())
+	}
+
+	if _, err := d.Write(encrypted[48:]); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if out.Len() != 48 {
+		t.Fatalf("wrote %d bytes, want 48", out.Len())
+	}
+}
+
+func TestDecryptWriterErrors(t *testing.T) {
+	valid := encrypt(t, []byte("segment"))
+
+	// a last block decrypting to a zero padding byte
+	block, err := aes.NewCipher(testKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zeroPadding := make([]byte, aes.BlockSize)
+	cipher.NewCBCEncrypter(block, testIV).CryptBlocks(zeroPadding, zeroPadding)
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"empty", nil},
+		{"truncated block", valid[:aes.BlockSize-1]},
+		{"not a multiple of the block size", append(bytes.Clone(valid), 0)},
+		{"zero padding", zeroPadding},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, err := newDecryptWriter(&bytes.Buffer{}, testKey, testIV)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := d.Write(tt.data); err != nil {
+				t.Fatal(err)
+			}
+			if err := d.Close(); err == nil {
+				t.Fatalf("Close() succeeded, want an error")
+			}
+		})
+	}
+
+	if _, err := newDecryptWriter(&bytes.Buffer{}, testKey, testIV[:8]); err == nil {
+		t.Errorf("newDecryptWriter() with a short IV succeeded, want an error")
+	}
+	if _, err := newDecryptWriter(&bytes.Buffer{}, testKey[:5], testIV); err == nil {
+		t.Errorf("newDecryptWriter() with a short key succeeded, want an error")
+	}
+}
@@ -0,0 +1,136 @@
+package segments
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"omnivorous/internal/m3u8"
+	"os"
+	"path/filepath"
+)
+
+const manifestName = "manifest.json"
+const manifestVersion = 1
+
+// Manifest records the state of a download in its cache dir, so an interrupted download can be resumed
+type Manifest struct {
+	Version int    `json:"version"`
+	Url     string `json:"url"`
+	Title   string `json:"title"`
+	// Variant is the stream selected from the master playlist
+	Variant m3u8.Stream `json:"variant"`
+	// Playlist is the media playlist of the variant with absolute URIs
+	Playlist string `json:"playlist"`
+	// Key and IV are set by downloaders that use one key for the whole video
+	Key      []byte         `json:"key,omitempty"`
+	IV       []byte         `json:"iv,omitempty"`
+	Segments []SegmentState `json:"segments"`
+}
+
+// SegmentState is the download state of a single segment
+type SegmentState struct {
+	Index  int    `json:"index"`
+	File   string `json:"file"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+	Done   bool   `json:"done"`
+}
+
+// LoadManifest reads the manifest from the cache dir
+// It returns nil if there is no manifest, it was written by an incompatible version or it cannot be decoded,
+// so the download starts over instead of failing on every run
+func LoadManifest(dir string) (*Manifest, error) {
+	filename := filepath.Join(dir, manifestName)
+	data, err := os.ReadFile(filename)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading manifest %s: %w", filename, err)
+	}
+
+	var m Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		slog.Warn("Ignoring undecodable manifest, starting the download over", "file", filename, "err", err)
+		return nil, nil
+	}
+
+	if m.Version != manifestVersion {
+		return nil, nil
+	}
+
+	return &m, nil
+}
+
+// NewManifest creates a manifest for the media playlist
+func NewManifest(url, title string, variant m3u8.Stream, playlist *m3u8.Playlist) (*Manifest, error) {
+	data, err := playlist.Marshal()
+	if err != nil {
+		return nil, fmt.Errorf("error serializing playlist: %w", err)
+	}
+
+	return &Manifest{
+		Version:  manifestVersion,
+		Url:      url,
+		Title:    title,
+		Variant:  variant,
+		Playlist: string(data),
+	}, nil
+}
+
+// MediaPlaylist parses the media playlist stored in the manifest
+func (m *Manifest) MediaPlaylist() (*m3u8.Playlist, error) {
+	playlist, err := m3u8.Parse(m.Playlist)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing manifest playlist: %w", err)
+	}
+
+	return playlist, nil
+}
+
+// Save writes the manifest to the cache dir
+// The manifest is written to a temporary file first, so a crash never leaves a truncated manifest
+func (m *Manifest) Save(dir string) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding manifest: %w", err)
+	}
+
+	filename := filepath.Join(dir, manifestName)
+	tmpFilename := filename + ".tmp"
+
+	if err := os.WriteFile(tmpFilename, data, 0644); err != nil {
+		return fmt.Errorf("error writing manifest: %w", err)
+	}
+
+	if err := os.Rename(tmpFilename, filename); err != nil {
+		return fmt.Errorf("error writing manifest: %w", err)
+	}
+
+	return nil
+}
+
+// verify reports whether the segment file is complete and matches the recorded size and checksum
+func (s *SegmentState) verify(dir string) bool {
+	if !s.Done || s.File == "" {
+		return false
+	}
+
+	file, err := os.Open(filepath.Join(dir, s.File))
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	size, err := io.Copy(hash, file)
+	if err != nil {
+		return false
+	}
+
+	return size == s.Size && hex.EncodeToString(hash.Sum(nil)) == s.SHA256
+}
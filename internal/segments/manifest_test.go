@@ -0,0 +1,58 @@
+package segments
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestLoadManifest(t *testing.T) {
+	t.Run("saved", func(t *testing.T) {
+		dir := t.TempDir()
+		want := &Manifest{
+			Version:  manifestVersion,
+			Url:      "https://example.com/video.m3u8",
+			Title:    "video",
+			Playlist: "#EXTM3U\n",
+			Segments: []SegmentState{{Index: 0, File: "00000.ts", Size: 3, SHA256: "abc", Done: true}},
+		}
+		if err := want.Save(dir); err != nil {
+			t.Fatalf("Save() error = %v", err)
+		}
+
+		got, err := LoadManifest(dir)
+		if err != nil {
+			t.Fatalf("LoadManifest() error = %v", err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("LoadManifest() = %+v, want %+v", got, want)
+		}
+	})
+
+	tests := []struct {
+		name string
+		data string
+	}{
+		{"missing", ""},
+		{"other version", `{"version": 0, "segments": []}`},
+		{"truncated", `{"version": 1, "segm`},
+		{"not JSON", "garbage"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			if tt.data != "" {
+				if err := os.WriteFile(filepath.Join(dir, manifestName), []byte(tt.data), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			got, err := LoadManifest(dir)
+			if err != nil || got != nil {
+				t.Errorf("LoadManifest() = %+v, %v, want no manifest and no error", got, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,433 @@
+package segments
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/schollz/progressbar/v3"
+	"io"
+	"net/url"
+	"omnivorous/internal/ffmpeg"
+	"omnivorous/internal/httpclient"
+	"omnivorous/internal/m3u8"
+	"omnivorous/internal/ratelimit"
+	"omnivorous/internal/retry"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// tmpSuffix marks segments that are still being written
+const tmpSuffix = ".part"
+
+// manifestSaveInterval is how often the manifest is saved while segments are downloaded
+// Segments finished since the last save are downloaded again after a crash
+const manifestSaveInterval = 5 * time.Second
+
+// KeyFunc returns the AES-128 key and IV the segment is encrypted with
+// A nil key means the segment is not encrypted
+type KeyFunc func(ctx context.Context, index int, segment m3u8.Segment) (key, iv []byte, err error)
+
+// Job describes a list of segments to download into a directory
+type Job struct {
+	Segments []m3u8.Segment
+	Dir      string
+	// Client downloads the segments, its retry policy covers the request as well as reading the body
+	Client *httpclient.Client
+	Key    KeyFunc
+	// Manifest records the progress of the job in Dir, segments it marks as done are not downloaded again
+	Manifest *Manifest
+	// Limiter limits the rate of reading segment bodies, it may be shared with other jobs and may be nil
+	Limiter *ratelimit.Limiter
+	// Concurrency is the number of simultaneous downloads, DefaultConcurrency is used if it is 0
+	// With AdaptiveConcurrency it is the maximum the number of downloads is adjusted up to
+	Concurrency         int
+	AdaptiveConcurrency bool
+}
+
+// InterruptedError is returned by Download when its context is cancelled
+// The segments downloaded so far are recorded in the manifest, so the download can be resumed
+type InterruptedError struct {
+	Done  int
+	Total int
+	Dir   string
+	Err   error
+}
+
+func (e *InterruptedError) Error() string {
+	return fmt.Sprintf("download interrupted, %d of %d segments saved in %s", e.Done, e.Total, e.Dir)
+}
+
+func (e *InterruptedError) Unwrap() error {
+	return e.Err
+}
+
+// Download downloads and decrypts all segments of the job
+// It returns the list of downloaded files in playlist order, the list is complete if the error is nil
+// The first failed segment stops scheduling more segments and aborts the running ones, the failures of all
+// segments that failed on their own are returned together
+// Once the context is cancelled, no more segments are started, the running downloads are aborted
+// and an *InterruptedError is returned after the manifest has been saved
+func Download(parent context.Context, job Job, bar *progressbar.ProgressBar) ([]string, error) {
+	ctx, cancel := context.WithCancel(parent)
+	defer cancel()
+
+	if len(job.Manifest.Segments) != len(job.Segments) {
+		job.Manifest.Segments = make([]SegmentState, len(job.Segments))
+		for i := range job.Manifest.Segments {
+			job.Manifest.Segments[i].Index = i
+		}
+	}
+
+	if err := job.Manifest.Save(job.Dir); err != nil {
+		return nil, err
+	}
+
+	if err := removeTempFiles(job.Dir); err != nil {
+		return nil, err
+	}
+
+	progress := &progress{manifest: job.Manifest, dir: job.Dir, lastSave: time.Now()}
+
+	// mutex guards the failures
+	var mutex sync.Mutex
+	var failures []error
+
+	slots := newPool(job.Concurrency, job.AdaptiveConcurrency)
+	indices := make(chan int)
+
+	var wg sync.WaitGroup
+	for range slots.max {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for i := range indices {
+				if slots.acquire(ctx) != nil {
+					continue
+				}
+
+				done, err := downloadAndRecord(ctx, job, i, slots, progress)
+
+				slots.release()
+
+				// segments aborted because of another failure or an interruption are not failures of their own
+				if err != nil && !errors.Is(err, context.Canceled) {
+					mutex.Lock()
+					failures = append(failures, fmt.Errorf("segment %d: %w", i, err))
+					mutex.Unlock()
+					cancel()
+				}
+
+				if done {
+					bar.Add(1)
+				}
+			}
+		}()
+	}
+
+schedule:
+	for i := range job.Segments {
+		select {
+		case indices <- i:
+		case <-ctx.Done():
+			break schedule
+		}
+	}
+	close(indices)
+
+	// aborted downloads remove their temp files, waiting for them leaves only complete segments behind
+	wg.Wait()
+
+	saveErr := job.Manifest.Save(job.Dir)
+
+	if parent.Err() != nil {
+		done := 0
+		for _, state := range job.Manifest.Segments {
+			if state.Done {
+				done++
+			}
+		}
+		return nil, &InterruptedError{Done: done, Total: len(job.Segments), Dir: job.Dir, Err: parent.Err()}
+	}
+
+	if len(failures) > 0 {
+		return nil, fmt.Errorf("%d of %d segments failed: %w", len(failures), len(job.Segments), errors.Join(failures...))
+	}
+
+	if saveErr != nil {
+		return nil, saveErr
+	}
+
+	fileList := make([]string, len(job.Segments))
+	for i, state := range job.Manifest.Segments {
+		if !state.Done || state.File == "" {
+			return nil, fmt.Errorf("segment %d was not downloaded", i)
+		}
+		fileList[i] = filepath.Join(job.Dir, state.File)
+	}
+
+	return fileList, nil
+}
+
+// downloadAndRecord downloads the segment unless the manifest records it as complete and records the result in the manifest
+// It reports whether the segment is done
+func downloadAndRecord(ctx context.Context, job Job, index int, slots *pool, progress *progress) (bool, error) {
+	state := progress.state(index)
+	if state.verify(job.Dir) {
+		return true, nil
+	}
+
+	segment := job.Segments[index]
+	err := job.Client.Retry(ctx, segment.Url, func() error {
+		var err error
+		state, err = downloadSegment(ctx, job, index, segment)
+		slots.report(state.Size, err)
+		return err
+	})
+	if err != nil {
+		return false, err
+	}
+
+	if err := progress.record(state); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// progress records finished segments in the manifest shared by the workers
+// The manifest is saved at most once per manifestSaveInterval, Download saves it once more before returning
+type progress struct {
+	mutex    sync.Mutex
+	manifest *Manifest
+	dir      string
+	lastSave time.Time
+}
+
+func (p *progress) state(index int) SegmentState {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	return p.manifest.Segments[index]
+}
+
+func (p *progress) record(state SegmentState) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.manifest.Segments[state.Index] = state
+
+	if time.Since(p.lastSave) < manifestSaveInterval {
+		return nil
+	}
+	p.lastSave = time.Now()
+
+	return p.manifest.Save(p.dir)
+}
+
+func downloadSegment(ctx context.Context, job Job, index int, segment m3u8.Segment) (SegmentState, error) {
+	state := SegmentState{Index: index}
+
+	if err := ctx.Err(); err != nil {
+		return state, err
+	}
+
+	segmentUrl, err := url.Parse(segment.Url)
+	if err != nil {
+		return state, fmt.Errorf("error parsing segment URL: %w", err)
+	}
+
+	ext := path.Ext(segmentUrl.Path)
+	if ext == "" {
+		ext = ".ts"
+	}
+
+	// segments are named by index, as generic playlists may reuse the same file name with different queries
+	state.File = fmt.Sprintf("%05d%s", index, ext)
+
+	var key, iv []byte
+	if job.Key != nil {
+		key, iv, err = job.Key(ctx, index, segment)
+		if err != nil {
+			return state, retry.Permanent(fmt.Errorf("error getting segment key: %w", err))
+		}
+	}
+
+	resp, err := job.Client.Fetch(ctx, segment.Url)
+	if err != nil {
+		return state, fmt.Errorf("error downloading segment: %w", err)
+	}
+	defer resp.Body.Close()
+
+	state.Size, state.SHA256, err = writeFile(job.Dir, state.File, func(w io.Writer) error {
+		return copySegment(w, job.Limiter.Reader(ctx, resp.Body), segment.Url, key, iv)
+	})
+	if err != nil {
+		return state, err
+	}
+	state.Done = true
+
+	return state, nil
+}
+
+// copySegment streams the segment body to w, decrypting it if key is set
+// Errors reading the body are retryable, the others are permanent
+func copySegment(w io.Writer, body io.Reader, url string, key, iv []byte) error {
+	var decrypter *decryptWriter
+	if key != nil {
+		var err error
+		decrypter, err = newDecryptWriter(w, key, iv)
+		if err != nil {
+			return retry.Permanent(fmt.Errorf("error decrypting segment: %w", err))
+		}
+		w = decrypter
+	}
+
+	reader := &errorReader{Reader: body}
+	if _, err := io.Copy(w, reader); err != nil {
+		if reader.err != nil {
+			return &httpclient.NetworkError{URL: url, Err: fmt.Errorf("error reading segment: %w", err)}
+		}
+		return retry.Permanent(fmt.Errorf("error writing to file: %w", err))
+	}
+
+	if decrypter != nil {
+		if err := decrypter.Close(); err != nil {
+			return retry.Permanent(fmt.Errorf("error decrypting segment: %w", err))
+		}
+	}
+
+	return nil
+}
+
+// errorReader records the error of the underlying reader, to tell read errors from write errors after io.Copy
+type errorReader struct {
+	io.Reader
+	err error
+}
+
+func (r *errorReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	if err != nil && err != io.EOF {
+		r.err = err
+	}
+	return n, err
+}
+
+// writeFile writes the segment to a temporary file and renames it once complete,
+// so the cache dir never contains a truncated segment under its final name
+// It returns the size and the SHA-256 checksum of the data written by write
+func writeFile(dir, name string, write func(w io.Writer) error) (int64, string, error) {
+	file, err := os.CreateTemp(dir, name+".*"+tmpSuffix)
+	if err != nil {
+		return 0, "", retry.Permanent(fmt.Errorf("error creating temp file: %w", err))
+	}
+	tmpFilename := file.Name()
+
+	// the temp file is removed on any failure, after a successful rename this is a no-op
+	defer os.Remove(tmpFilename)
+	defer file.Close()
+
+	hash := sha256.New()
+	counter := &countingWriter{}
+	if err := write(io.MultiWriter(file, hash, counter)); err != nil {
+		return 0, "", err
+	}
+	size := counter.n
+
+	if err := file.Sync(); err != nil {
+		return 0, "", retry.Permanent(fmt.Errorf("error syncing file: %w", err))
+	}
+
+	if err := file.Close(); err != nil {
+		return 0, "", retry.Permanent(fmt.Errorf("error closing file: %w", err))
+	}
+
+	if err := os.Rename(tmpFilename, filepath.Join(dir, name)); err != nil {
+		return 0, "", retry.Permanent(fmt.Errorf("error renaming file: %w", err))
+	}
+
+	return size, hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+type countingWriter struct {
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.n += int64(len(p))
+	return len(p), nil
+}
+
+// removeTempFiles removes segments left half written by an interrupted run
+func removeTempFiles(dir string) error {
+	files, err := filepath.Glob(filepath.Join(dir, "*"+tmpSuffix))
+	if err != nil {
+		return fmt.Errorf("error listing temp files: %w", err)
+	}
+
+	for _, file := range files {
+		if err := os.Remove(file); err != nil {
+			return fmt.Errorf("error removing temp file: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// Join muxes the downloaded files into a single output file of the container format
+// The file is written next to output under a temp name and renamed on success, so output is either complete or absent
+// Once the context is cancelled the join stops and an *InterruptedError is returned, the segments stay in dir for resuming
+func Join(ctx context.Context, fileList []string, dir, output string, container ffmpeg.Container) error {
+	ffmpegInputFile, err := generateFfmpegInputFile(fileList, dir)
+	if err != nil {
+		return fmt.Errorf("error generating ffmpeg input file: %w", err)
+	}
+
+	tmpOutput := output + tmpSuffix
+
+	err = ffmpeg.JoinFiles(ctx, ffmpegInputFile, tmpOutput, container)
+	if err != nil {
+		os.Remove(tmpOutput)
+		if ctx.Err() != nil {
+			return &InterruptedError{Done: len(fileList), Total: len(fileList), Dir: dir, Err: ctx.Err()}
+		}
+		return fmt.Errorf("error joining files: %w", err)
+	}
+
+	if err := os.Rename(tmpOutput, output); err != nil {
+		os.Remove(tmpOutput)
+		return fmt.Errorf("error renaming output file: %w", err)
+	}
+
+	return nil
+}
+
+func generateFfmpegInputFile(fileList []string, dir string) (string, error) {
+	lines := make([]string, len(fileList))
+	for i, file := range fileList {
+		lines[i] = fmt.Sprintf("file '%s'", file)
+	}
+
+	content := strings.Join(lines, "\n")
+	filename := filepath.Join(dir, "input.txt")
+
+	file, err := os.OpenFile(filename, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return "", fmt.Errorf("error opening file: %w", err)
+	}
+	defer file.Close()
+
+	_, err = file.WriteString(content)
+	if err != nil {
+		return "", fmt.Errorf("error writing to file: %w", err)
+	}
+
+	return filename, nil
+}
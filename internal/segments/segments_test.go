@@ -0,0 +1,216 @@
+package segments
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/schollz/progressbar/v3"
+	"net/http"
+	"net/http/httptest"
+	"omnivorous/internal/httpclient"
+	"omnivorous/internal/m3u8"
+	"omnivorous/internal/retry"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// segmentServer serves the segments /0.ts, /1.ts, ... with the body "segment N"
+// handle may answer a request itself, it returns false to serve the segment
+type segmentServer struct {
+	*httptest.Server
+	hits   []atomic.Int32
+	handle func(w http.ResponseWriter, r *http.Request, index int) bool
+}
+
+func newSegmentServer(t *testing.T, count int) *segmentServer {
+	t.Helper()
+
+	s := &segmentServer{hits: make([]atomic.Int32, count)}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var index int
+		if _, err := fmt.Sscanf(r.URL.Path, "/%d.ts", &index); err != nil || index >= count {
+			http.NotFound(w, r)
+			return
+		}
+		s.hits[index].Add(1)
+
+		if s.handle != nil && s.handle(w, r, index) {
+			return
+		}
+		fmt.Fprintf(w, "segment %d", index)
+	}))
+	t.Cleanup(s.Close)
+
+	return s
+}
+
+func (s *segmentServer) job(t *testing.T, concurrency int) Job {
+	t.Helper()
+
+	segments := make([]m3u8.Segment, len(s.hits))
+	for i := range segments {
+		segments[i] = m3u8.Segment{Url: fmt.Sprintf("%s/%d.ts", s.URL, i), Duration: time.Second, Sequence: i}
+	}
+
+	return Job{
+		Segments:    segments,
+		Dir:         t.TempDir(),
+		Client:      httpclient.NewWithHTTPClient(s.Client(), retry.Policy{MaxAttempts: 1}),
+		Manifest:    &Manifest{Version: manifestVersion},
+		Concurrency: concurrency,
+	}
+}
+
+func (s *segmentServer) totalHits() int {
+	total := 0
+	for i := range s.hits {
+		total += int(s.hits[i].Load())
+	}
+	return total
+}
+
+// checkFiles checks that the file list holds every segment in playlist order
+func checkFiles(t *testing.T, files []string, count int) {
+	t.Helper()
+
+	if len(files) != count {
+		t.Fatalf("Download() returned %d files, want %d", len(files), count)
+	}
+	for i, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatalf("file %d: %v", i, err)
+		}
+		if want := fmt.Sprintf("segment %d", i); string(data) != want {
+			t.Errorf("file %d = %q, want %q", i, data, want)
+		}
+	}
+}
+
+func TestDownload(t *testing.T) {
+	server := newSegmentServer(t, 25)
+	job := server.job(t, 4)
+
+	files, err := Download(context.Background(), job, progressbar.DefaultSilent(25))
+	if err != nil {
+		t.Fatalf("Download() error = %v", err)
+	}
+	checkFiles(t, files, 25)
+
+	manifest, err := LoadManifest(job.Dir)
+	if err != nil || manifest == nil {
+		t.Fatalf("LoadManifest() = %v, %v, want the saved manifest", manifest, err)
+	}
+	for i, state := range manifest.Segments {
+		if !state.Done {
+			t.Errorf("manifest segment %d is not done", i)
+		}
+	}
+}
+
+func TestDownloadStopsAfterPermanentFailure(t *testing.T) {
+	server := newSegmentServer(t, 20)
+	server.handle = func(w http.ResponseWriter, r *http.Request, index int) bool {
+		if index == 2 {
+			http.Error(w, "gone", http.StatusGone)
+			return true
+		}
+		return false
+	}
+	job := server.job(t, 1)
+
+	files, err := Download(context.Background(), job, progressbar.DefaultSilent(20))
+	var statusErr *httpclient.StatusError
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusGone {
+		t.Fatalf("Download() error = %v, want the 410 status error", err)
+	}
+	if files != nil {
+		t.Errorf("Download() files = %v, want nil with an error", files)
+	}
+
+	// segments 0 and 1 succeeded, 2 failed, nothing was scheduled after it
+	if hits := server.totalHits(); hits != 3 {
+		t.Errorf("server got %d requests, want 3", hits)
+	}
+}
+
+func TestDownloadJoinsConcurrentFailures(t *testing.T) {
+	server := newSegmentServer(t, 3)
+	job := server.job(t, 3)
+
+	// every segment fails only once all of them are running, so none is aborted by another failure
+	var running sync.WaitGroup
+	running.Add(3)
+	job.Key = func(ctx context.Context, index int, segment m3u8.Segment) ([]byte, []byte, error) {
+		running.Done()
+		running.Wait()
+		return nil, nil, fmt.Errorf("key %d unavailable", index)
+	}
+
+	files, err := Download(context.Background(), job, progressbar.DefaultSilent(3))
+	if err == nil {
+		t.Fatalf("Download() = %v, want an error", files)
+	}
+	if !strings.Contains(err.Error(), "3 of 3 segments failed") {
+		t.Errorf("Download() error = %v, want all 3 failures", err)
+	}
+	for i := range 3 {
+		if want := fmt.Sprintf("segment %d: error getting segment key: key %d unavailable", i, i); !strings.Contains(err.Error(), want) {
+			t.Errorf("Download() error = %v, want it to contain %q", err, want)
+		}
+	}
+}
+
+func TestDownloadResumesAfterInterruption(t *testing.T) {
+	server := newSegmentServer(t, 10)
+	job := server.job(t, 1)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// the first run stops at segment 5, which hangs until the download is cancelled
+	var blocking atomic.Bool
+	blocking.Store(true)
+	server.handle = func(w http.ResponseWriter, r *http.Request, index int) bool {
+		if index < 5 || !blocking.Load() {
+			return false
+		}
+		cancel()
+		<-r.Context().Done()
+		return true
+	}
+
+	files, err := Download(ctx, job, progressbar.DefaultSilent(10))
+	var interruptedErr *InterruptedError
+	if !errors.As(err, &interruptedErr) {
+		t.Fatalf("Download() = %v, %v, want an *InterruptedError", files, err)
+	}
+	if interruptedErr.Done != 5 || interruptedErr.Total != 10 || !errors.Is(err, context.Canceled) {
+		t.Errorf("Download() error = %+v, want 5 of 10 segments done and context.Canceled", interruptedErr)
+	}
+
+	manifest, err := LoadManifest(job.Dir)
+	if err != nil || manifest == nil {
+		t.Fatalf("LoadManifest() = %v, %v, want the saved manifest", manifest, err)
+	}
+
+	blocking.Store(false)
+	job.Manifest = manifest
+
+	files, err = Download(context.Background(), job, progressbar.DefaultSilent(10))
+	if err != nil {
+		t.Fatalf("Download() of the resumed job error = %v", err)
+	}
+	checkFiles(t, files, 10)
+
+	// the segments saved by the first run are not downloaded again
+	for i := range 5 {
+		if hits := server.hits[i].Load(); hits != 1 {
+			t.Errorf("segment %d was requested %d times, want once", i, hits)
+		}
+	}
+}